@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/LandonTClipp/pciex/models"
+)
+
+// analyses are the reports of `pciex analyze`.
+var analyses = []command{
+	{name: "bandwidth", summary: "compare the uplink of every switch with the links below it", run: runAnalyzeBandwidth},
+}
+
+func runAnalyze(args []string) error {
+	return runSubcommand("pciex analyze", "analysis", analyses, args)
+}
+
+func runAnalyzeBandwidth(args []string) error {
+	opts := collectOptions{}
+	fs := newFlagSet("pciex analyze bandwidth", "")
+	opts.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	tree, err := collectTree(opts)
+	if err != nil {
+		return err
+	}
+	fmt.Print(models.BandwidthReport(models.AnalyzeBandwidth(tree.Root)))
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/LandonTClipp/pciex/models"
+)
+
+// checks are the checks of `pciex check`. They exit with status 1 if they
+// find a problem.
+var checks = []command{
+	{name: "p2p", summary: "report whether ACS redirects peer-to-peer requests between devices to the root complex", run: runCheckP2P},
+}
+
+func runCheck(args []string) error {
+	return runSubcommand("pciex check", "check", checks, args)
+}
+
+func runCheckP2P(args []string) error {
+	var (
+		opts   collectOptions
+		filter string
+	)
+	fs := newFlagSet("pciex check p2p", "")
+	opts.register(fs)
+	fs.StringVar(&filter, "filter", models.DefaultP2PFilter, "filter expression selecting the devices to check")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	f, err := models.ParseFilter(filter)
+	if err != nil {
+		return err
+	}
+	tree, err := collectTree(opts)
+	if err != nil {
+		return err
+	}
+	results := models.CheckP2P(models.P2PDevices(tree.Root, f))
+	fmt.Print(models.P2PReadinessReport(results))
+	for _, r := range results {
+		if r.Routing == models.P2PRedirected {
+			return exitCode(1)
+		}
+	}
+	return nil
+}
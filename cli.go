@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/LandonTClipp/pciex/models"
+)
+
+// exitCode is returned by commands that finished normally but need to exit
+// with a nonzero status, such as diff when the topologies differ.
+type exitCode int
+
+func (e exitCode) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// command is a non-interactive subcommand, such as `pciex tree`.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{name: "tree", summary: "print the PCIe topology tree", run: runTree},
+	{name: "show", args: "<address>", summary: "print the details of a single device", run: runShow},
+	{name: "export", summary: "write the topology as JSON or YAML", run: runExport},
+	{name: "diff", args: "<before> [<after>]", summary: "compare two snapshots, or a snapshot and this machine", run: runDiff},
+	{name: "path", args: "<address> <address>", summary: "print the route between two devices and its slowest link", run: runPath},
+	{name: "topo", summary: "print the peer-to-peer path between devices, like nvidia-smi topo -m", run: runTopo},
+	{name: "iommu", summary: "list the IOMMU groups and the devices that must be passed through together", run: runIOMMU},
+	{name: "analyze", args: "<analysis>", summary: "analyze the topology, such as switch bandwidth oversubscription", run: runAnalyze},
+	{name: "check", args: "<check>", summary: "check the topology for problems, such as ACS blocking peer-to-peer", run: runCheck},
+	{name: "validate", args: "-spec <file>", summary: "check the topology against an expected-topology spec", run: runValidate},
+	{name: "serve", args: "-metrics <addr> | -http <addr>", summary: "rescan periodically and serve Prometheus metrics or a JSON API", run: runServe},
+}
+
+func (o *collectOptions) register(fs *flag.FlagSet) {
+	o.registerLive(fs)
+	fs.StringVar(&o.from, "from", "", "read the topology from a saved lshw -json output or pciex export instead of this machine")
+}
+
+// registerLive registers only the flags that control how this machine is
+// scanned, for commands that take their files as arguments.
+func (o *collectOptions) registerLive(fs *flag.FlagSet) {
+	fs.StringVar(&o.collector, "collector", "sysfs", "how to discover devices: sysfs or lshw")
+	fs.StringVar(&o.sysfsRoot, "sysfs-root", "/sys", "where sysfs is mounted")
+}
+
+// filterOption is the -filter flag of the commands that print the topology.
+type filterOption string
+
+func (o *filterOption) register(fs *flag.FlagSet) {
+	fs.StringVar((*string)(o), "filter", "", "only include devices matching this filter expression, and the bridges above them")
+}
+
+// apply prunes the tree to the devices matching the filter, if there is
+// one.
+func (o filterOption) apply(tree *models.TreeModel) error {
+	if o == "" {
+		return nil
+	}
+	f, err := models.ParseFilter(string(o))
+	if err != nil {
+		return err
+	}
+	tree.SetFilter(f)
+	return nil
+}
+
+func newFlagSet(name string, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s\n\nFlags:\n", strings.TrimSpace(name+" [flags] "+args))
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: pciex [flags]\n       pciex <command> [flags] [args]\n\n")
+	fmt.Fprintf(w, "Without a command, pciex starts the interactive explorer.\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-25s %s\n", strings.TrimSpace(c.name+" "+c.args), c.summary)
+	}
+	fmt.Fprintf(w, "\nRun 'pciex <command> -h' for the flags of a command.\n")
+}
+
+// run dispatches to the subcommand named by the first argument, or starts
+// the TUI if there isn't one.
+func run(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runTUI(args)
+	}
+	if args[0] == "help" {
+		printUsage(os.Stdout)
+		return nil
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:])
+		}
+	}
+	printUsage(os.Stderr)
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+// runSubcommand dispatches to one of the subcommands of a command such as
+// `pciex analyze`. kind names the subcommands in usage and errors.
+func runSubcommand(name string, kind string, subcommands []command, args []string) error {
+	if len(args) > 0 {
+		for _, c := range subcommands {
+			if c.name == args[0] {
+				return c.run(args[1:])
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Usage: %s <%s> [flags]\n\nAvailable:\n", name, kind)
+	for _, c := range subcommands {
+		fmt.Fprintf(os.Stderr, "  %-25s %s\n", c.name, c.summary)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("missing %s", kind)
+	}
+	return fmt.Errorf("unknown %s %q", kind, args[0])
+}
+
+// collectTree builds the topology without any of the interactive models.
+func collectTree(opts collectOptions) (*models.TreeModel, error) {
+	tree := models.NewTreeModel()
+	if err := buildPCIETree(tree, opts); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+func runTree(args []string) error {
+	var (
+		opts   collectOptions
+		filter filterOption
+		vfs    bool
+	)
+	fs := newFlagSet("pciex tree", "")
+	opts.register(fs)
+	filter.register(fs)
+	fs.BoolVar(&vfs, "vfs", false, "list the virtual functions of SR-IOV devices instead of only counting them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	tree, err := collectTree(opts)
+	if err != nil {
+		return err
+	}
+	if vfs {
+		tree.ExpandAll()
+	}
+	if err := filter.apply(tree); err != nil {
+		return err
+	}
+	// lipgloss drops colors on its own when stdout isn't a terminal or
+	// NO_COLOR is set, so the same rendering works for pipes and logs.
+	fmt.Println(tree.View())
+	return nil
+}
+
+func runShow(args []string) error {
+	opts := collectOptions{}
+	fs := newFlagSet("pciex show", "<address>")
+	opts.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one device address")
+	}
+	tree, err := collectTree(opts)
+	if err != nil {
+		return err
+	}
+	node := tree.Root.FindByAddress(fs.Arg(0))
+	if node == nil {
+		return fmt.Errorf("no device with address %s", fs.Arg(0))
+	}
+	fmt.Printf("%s: %s\n", node.Detail.Businfo, node.Value())
+	fmt.Print(node.GetDetail())
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/LandonTClipp/pciex/models"
+)
+
+func runDiff(args []string) error {
+	var (
+		opts collectOptions
+		tui  bool
+	)
+	fs := newFlagSet("pciex diff", "<before> [<after>]")
+	usage := fs.Usage
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintf(fs.Output(), "\n<before> and <after> are files written by pciex export or lshw -json.\nWithout <after>, <before> is compared against this machine.\n")
+	}
+	opts.registerLive(fs)
+	fs.BoolVar(&tui, "tui", false, "browse the differences in the interactive explorer")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return errors.New("expected one or two snapshots")
+	}
+
+	before := models.NewTreeModel()
+	if err := buildPCIETreeFromFile(before, fs.Arg(0)); err != nil {
+		return err
+	}
+	// Without a second snapshot, compare against the live system.
+	afterOpts := opts
+	if fs.NArg() == 2 {
+		afterOpts.from = fs.Arg(1)
+	}
+
+	if tui {
+		rootModel, err := models.NewRootModel()
+		if err != nil {
+			return err
+		}
+		if err := buildPCIETree(rootModel.Tree, afterOpts); err != nil {
+			return err
+		}
+		changes := models.Diff(before.Root, rootModel.Tree.Root)
+		rootModel.Tree.ApplyDiff(before.Root, changes)
+		return runProgram(rootModel)
+	}
+
+	after, err := collectTree(afterOpts)
+	if err != nil {
+		return err
+	}
+	changes := models.Diff(before.Root, after.Root)
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	if len(changes) > 0 {
+		return exitCode(1)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/LandonTClipp/pciex/models"
+	"gopkg.in/yaml.v2"
+)
+
+func writeSnapshotJSON(w io.Writer, snapshot models.Snapshot) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(snapshot); err != nil {
+		return fmt.Errorf("encoding json: %w", err)
+	}
+	return nil
+}
+
+func writeSnapshotYAML(w io.Writer, snapshot models.Snapshot) error {
+	out, err := yaml.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("marshalling yaml: %w", err)
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// exportFormat is a format `pciex export` can write the topology in.
+type exportFormat struct {
+	name string
+	// description is shown in the help of -format.
+	description string
+	write       func(w io.Writer, tree *models.TreeModel, collector string) error
+}
+
+var exportFormats = []exportFormat{
+	{"json", "snapshot", func(w io.Writer, tree *models.TreeModel, collector string) error {
+		return writeSnapshotJSON(w, models.NewSnapshot(tree.Root, tree.Hostname, collector))
+	}},
+	{"yaml", "snapshot", func(w io.Writer, tree *models.TreeModel, collector string) error {
+		return writeSnapshotYAML(w, models.NewSnapshot(tree.Root, tree.Hostname, collector))
+	}},
+	{"html", "report", func(w io.Writer, tree *models.TreeModel, _ string) error {
+		return tree.WriteHTML(w)
+	}},
+	{"dot", "Graphviz graph", func(w io.Writer, tree *models.TreeModel, _ string) error {
+		return tree.WriteDOT(w)
+	}},
+	{"mermaid", "Mermaid graph", func(w io.Writer, tree *models.TreeModel, _ string) error {
+		return tree.WriteMermaid(w)
+	}},
+}
+
+func findExportFormat(name string) (exportFormat, error) {
+	for _, f := range exportFormats {
+		if f.name == name {
+			return f, nil
+		}
+	}
+	return exportFormat{}, fmt.Errorf("unknown format %q", name)
+}
+
+func exportFormatsHelp() string {
+	formats := []string{}
+	for _, f := range exportFormats {
+		formats = append(formats, fmt.Sprintf("%s (%s)", f.name, f.description))
+	}
+	return "output format: " + strings.Join(formats, ", ")
+}
+
+// parseSnapshot reads a json or yaml snapshot.
+func parseSnapshot(b []byte) (models.Snapshot, error) {
+	snapshot := models.Snapshot{}
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		if yamlErr := yaml.Unmarshal(b, &snapshot); yamlErr != nil {
+			return snapshot, fmt.Errorf("unmarshalling snapshot: %w", yamlErr)
+		}
+	}
+	if snapshot.SchemaVersion > models.SnapshotSchemaVersion {
+		return snapshot, fmt.Errorf("unsupported schema version %d, newest supported is %d", snapshot.SchemaVersion, models.SnapshotSchemaVersion)
+	}
+	return snapshot, nil
+}
+
+func runExport(args []string) error {
+	var (
+		opts   collectOptions
+		filter filterOption
+		format string
+		output string
+	)
+	fs := newFlagSet("pciex export", "")
+	opts.register(fs)
+	filter.register(fs)
+	fs.StringVar(&format, "format", "json", exportFormatsHelp())
+	fs.StringVar(&output, "o", "-", "file to write to, or - for stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	exporter, err := findExportFormat(format)
+	if err != nil {
+		return err
+	}
+	tree, err := collectTree(opts)
+	if err != nil {
+		return err
+	}
+	if err := filter.apply(tree); err != nil {
+		return err
+	}
+	if output == "-" {
+		return exporter.write(os.Stdout, tree, opts.collectorName())
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+	if err := exporter.write(f, tree, opts.collectorName()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing output file: %w", err)
+	}
+	return nil
+}
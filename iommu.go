@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/LandonTClipp/pciex/models"
+)
+
+func runIOMMU(args []string) error {
+	opts := collectOptions{}
+	fs := newFlagSet("pciex iommu", "")
+	opts.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	tree, err := collectTree(opts)
+	if err != nil {
+		return err
+	}
+	fmt.Print(models.IOMMUReport(models.IOMMUGroups(tree.Root)))
+	return nil
+}
@@ -6,14 +6,19 @@ package main
 // dependencies.
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/LandonTClipp/pciex/models"
 	"github.com/LandonTClipp/pciex/pcie"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/chigopher/pathlib"
+	"gopkg.in/yaml.v2"
 )
 
 type Slot struct {
@@ -41,70 +46,318 @@ type LshwElem struct {
 	Children []LshwElem
 }
 
-func buildPCIETreeHelper(parent *models.Node, children []LshwElem) error {
+func buildPCIETreeHelper(parent *models.Node, children []LshwElem, enrich bool) error {
 	if parent == nil {
 		panic("parent is nil")
 	}
 	for _, child := range children {
-		if err := child.Details.GetAdditionalDetails(); err != nil {
-			return fmt.Errorf("getting additional details after json unmarshal: %w", err)
+		if enrich {
+			if err := child.Details.GetAdditionalDetails(); err != nil {
+				return fmt.Errorf("getting additional details after json unmarshal: %w", err)
+			}
 		}
 		childNode := parent.AddChild(child.Details.String(), child.Details)
-		if err := buildPCIETreeHelper(childNode, child.Children); err != nil {
+		if err := buildPCIETreeHelper(childNode, child.Children, enrich); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func buildPCIETree(tree *models.TreeModel) error {
-	cmd := exec.Command("/usr/bin/lshw", "-json")
-	out, err := cmd.Output()
+func addDevices(parent *models.Node, devices []*pcie.Device) {
+	for _, device := range devices {
+		childNode := parent.AddChild(device.Details.String(), device.Details)
+		addDevices(childNode, device.Children)
+	}
+}
+
+type collectOptions struct {
+	collector string
+	sysfsRoot string
+	// from is a previously captured lshw JSON file or pciex export to read
+	// instead of the live system.
+	from string
+}
+
+// collectorName describes where the topology came from.
+func (o collectOptions) collectorName() string {
+	if o.from != "" {
+		return "file"
+	}
+	return o.collector
+}
+
+func buildPCIETree(tree *models.TreeModel, opts collectOptions) error {
+	if opts.from != "" {
+		return buildPCIETreeFromFile(tree, opts.from)
+	}
+	c, err := newLiveCollector(opts)
+	if err != nil {
+		return err
+	}
+	return c.build(tree)
+}
+
+// liveCollector builds the topology of this machine. What doesn't change
+// between scans, like the hostname and the names of devices and modules, is
+// loaded once so that rescans in watch mode only walk the devices.
+type liveCollector struct {
+	hostname string
+	// sysfs is nil if the topology is collected with lshw.
+	sysfs *pcie.Sysfs
+}
+
+func newLiveCollector(opts collectOptions) (*liveCollector, error) {
+	hostname, err := os.Hostname()
 	if err != nil {
-		return fmt.Errorf("reading command output: %w", err)
+		return nil, fmt.Errorf("getting hostname from os: %w", err)
+	}
+	c := &liveCollector{hostname: hostname}
+	switch opts.collector {
+	case "sysfs":
+		c.sysfs = pcie.NewSysfs(pathlib.NewPath(opts.sysfsRoot))
+		if c.sysfs.IDs, err = pcie.FindIDDatabase(); err != nil {
+			return nil, fmt.Errorf("loading pci.ids: %w", err)
+		}
+		if c.sysfs.Aliases, err = pcie.FindModuleAliases(); err != nil {
+			return nil, fmt.Errorf("loading modules.alias: %w", err)
+		}
+	case "lshw":
+		if pcie.DefaultSysfs.Aliases, err = pcie.FindModuleAliases(); err != nil {
+			return nil, fmt.Errorf("loading modules.alias: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown collector %q", opts.collector)
+	}
+	return c, nil
+}
+
+func (c *liveCollector) build(tree *models.TreeModel) error {
+	tree.Hostname = c.hostname
+	if c.sysfs != nil {
+		return buildPCIETreeFromSysfs(tree, c.sysfs)
 	}
+	return buildPCIETreeFromLshw(tree)
+}
+
+func buildPCIETreeFromSysfs(tree *models.TreeModel, sysfs *pcie.Sysfs) error {
+	devices, err := sysfs.Walk()
+	if err != nil {
+		return fmt.Errorf("walking sysfs: %w", err)
+	}
+	if len(devices) == 0 {
+		return fmt.Errorf("no PCI devices found under %s", sysfs.Root)
+	}
+	tree.Root = models.NewNode("root", pcie.Details{}, nil, tree)
+	addDevices(tree.Root, devices)
+	models.GroupVirtualFunctions(tree.Root)
+	tree.Refresher = sysfs.Refresh
+	return nil
+}
+
+// parseLshw unmarshals the output of `lshw -json`.
+func parseLshw(out []byte) (LshwElem, error) {
 	lshw := LshwElem{}
 	if err := json.Unmarshal(out, &lshw); err != nil {
 		// Some versions of lshw wrap the JSON in a single-element array.
 		// Why? I don't know. See if we can successfully unmarshal into an
 		// array.
 		lshwArray := []LshwElem{}
-		if newErr := json.Unmarshal(out, &lshwArray); newErr != nil {
-			return fmt.Errorf("unmarshalling json: %w", err)
+		if newErr := json.Unmarshal(out, &lshwArray); newErr != nil || len(lshwArray) == 0 {
+			return lshw, fmt.Errorf("unmarshalling json: %w", err)
 		}
 		lshw = lshwArray[0]
 	}
+	if len(lshw.Children) == 0 {
+		return lshw, errors.New("lshw output has no core element")
+	}
+	return lshw, nil
+}
+
+// addLshw builds the tree out of the PCI elements of the lshw output. If
+// enrich is set, the details lshw doesn't provide are read from this
+// machine's sysfs.
+func addLshw(tree *models.TreeModel, lshw LshwElem, enrich bool) error {
 	tree.Root = models.NewNode("root", pcie.Details{}, nil, tree)
 	// Find PCI element
 	for _, child := range lshw.Children[0].Children {
 		if !strings.HasPrefix(child.Id, "pci") {
 			continue
 		}
-		if err := child.Details.GetAdditionalDetails(); err != nil {
-			return fmt.Errorf("getting additional details after json unmarshal: %w", err)
+		if enrich {
+			if err := child.Details.GetAdditionalDetails(); err != nil {
+				return fmt.Errorf("getting additional details after json unmarshal: %w", err)
+			}
 		}
 		childNode := tree.Root.AddChild(child.String(), child.Details)
-		if err := buildPCIETreeHelper(childNode, child.Children); err != nil {
+		if err := buildPCIETreeHelper(childNode, child.Children, enrich); err != nil {
 			return err
 		}
 	}
+	models.GroupVirtualFunctions(tree.Root)
 	return nil
 }
 
-func main() {
+func runLshw() (LshwElem, error) {
+	cmd := exec.Command("/usr/bin/lshw", "-json")
+	out, err := cmd.Output()
+	if err != nil {
+		return LshwElem{}, fmt.Errorf("reading command output: %w", err)
+	}
+	return parseLshw(out)
+}
+
+func buildPCIETreeFromLshw(tree *models.TreeModel) error {
+	lshw, err := runLshw()
+	if err != nil {
+		return err
+	}
+	if err := addLshw(tree, lshw, true); err != nil {
+		return err
+	}
+	tree.Refresher = refreshFromLshw
+	return nil
+}
+
+func findLshwElem(elem LshwElem, businfo string) (LshwElem, bool) {
+	if elem.Businfo == businfo {
+		return elem, true
+	}
+	for _, child := range elem.Children {
+		if found, ok := findLshwElem(child, businfo); ok {
+			return found, true
+		}
+	}
+	return LshwElem{}, false
+}
+
+// refreshFromLshw reruns lshw, since it can't be asked about a single
+// device, and picks out the one being refreshed.
+func refreshFromLshw(d pcie.Details) (pcie.Details, error) {
+	if d.Businfo == "" {
+		return d, nil
+	}
+	lshw, err := runLshw()
+	if err != nil {
+		return d, err
+	}
+	elem, ok := findLshwElem(lshw, d.Businfo)
+	if !ok {
+		return d, fmt.Errorf("%s is no longer present", d.Businfo)
+	}
+	if err := elem.Details.GetAdditionalDetails(); err != nil {
+		return d, fmt.Errorf("getting additional details after json unmarshal: %w", err)
+	}
+	return elem.Details, nil
+}
+
+// buildPCIETreeFromFile loads either a pciex export or the output of
+// `lshw -json` captured on another machine. Since the file doesn't describe
+// this machine, nothing is read from the local sysfs.
+func buildPCIETreeFromFile(tree *models.TreeModel, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+
+	var probe struct {
+		SchemaVersion int `json:"schema_version" yaml:"schema_version"`
+	}
+	if err := json.Unmarshal(b, &probe); err != nil {
+		// Either lshw's array form or a YAML export.
+		_ = yaml.Unmarshal(b, &probe)
+	}
+	if probe.SchemaVersion > 0 {
+		snapshot, err := parseSnapshot(b)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", path, err)
+		}
+		snapshot.Build(tree)
+		return nil
+	}
+
+	lshw, err := parseLshw(b)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	// The top-level element of lshw is the machine itself, named after
+	// its hostname.
+	tree.Hostname = lshw.Id
+	return addLshw(tree, lshw, false)
+}
+
+func runTUI(args []string) error {
+	var (
+		opts     collectOptions
+		filter   filterOption
+		watch    bool
+		interval time.Duration
+	)
+	fs := flag.NewFlagSet("pciex", flag.ContinueOnError)
+	fs.Usage = func() {
+		printUsage(fs.Output())
+		fmt.Fprintf(fs.Output(), "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	opts.register(fs)
+	filter.register(fs)
+	fs.BoolVar(&watch, "watch", false, "rescan periodically and update the tree as devices are hotplugged")
+	fs.DurationVar(&interval, "interval", 2*time.Second, "how often to rescan in watch mode")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if watch && opts.from != "" {
+		return fmt.Errorf("-watch can't be used with -from")
+	}
+
 	rootModel, err := models.NewRootModel()
 	if err != nil {
-		fmt.Printf("%v\n", err)
-		os.Exit(1)
+		return err
 	}
-	if err := buildPCIETree(rootModel.Tree); err != nil {
-		fmt.Printf("Error occurred: %v\n", err)
-		os.Exit(1)
+	if !watch {
+		if err := buildPCIETree(rootModel.Tree, opts); err != nil {
+			return err
+		}
+	} else {
+		c, err := newLiveCollector(opts)
+		if err != nil {
+			return err
+		}
+		if err := c.build(rootModel.Tree); err != nil {
+			return err
+		}
+		rootModel.Tree.Watch(models.ScannerFunc(func() (*models.Node, error) {
+			tree := models.NewTreeModel()
+			if err := c.build(tree); err != nil {
+				return nil, err
+			}
+			return tree.Root, nil
+		}), interval)
+	}
+	if err := filter.apply(rootModel.Tree); err != nil {
+		return err
 	}
+	return runProgram(rootModel)
+}
 
+func runProgram(rootModel *models.RootModel) error {
 	p := tea.NewProgram(rootModel)
 	if _, err := p.Run(); err != nil {
-		fmt.Printf("Error occurred: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		var code exitCode
+		if errors.As(err, &code) {
+			os.Exit(int(code))
+		}
+		fmt.Fprintf(os.Stderr, "Error occurred: %v\n", err)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/LandonTClipp/pciex/pcie"
+)
+
+// ACS returns the node's Access Control Services capability, or nil if it
+// doesn't have one or its config space wasn't read.
+func (n *Node) ACS() *pcie.ACSCapability {
+	if n.Detail.Config == nil {
+		return nil
+	}
+	return n.Detail.Config.ACS()
+}
+
+// RedirectsP2P reports whether peer-to-peer requests entering the node are
+// redirected upstream to the root complex by ACS.
+func (n *Node) RedirectsP2P() bool {
+	acs := n.ACS()
+	return acs != nil && acs.Control.RequestRedirect
+}
+
+// P2PRouting is how peer-to-peer requests between two devices are routed.
+type P2PRouting string
+
+const (
+	// P2PDirect requests are routed by the switch or multi-function device
+	// both devices are behind, without involving the root complex.
+	P2PDirect P2PRouting = "direct"
+	// P2PRedirected requests could be routed directly, but ACS redirects
+	// them to the root complex.
+	P2PRedirected P2PRouting = "redirected"
+	// P2PRootComplex requests have to go through the root complex because
+	// the devices don't share a switch.
+	P2PRootComplex P2PRouting = "root complex"
+	// P2PUnknown is used when the ACS capability of the port that decides
+	// couldn't be read.
+	P2PUnknown P2PRouting = "unknown"
+)
+
+// P2PReadiness is the routing of peer-to-peer requests between a pair of
+// devices.
+type P2PReadiness struct {
+	A       *Node
+	B       *Node
+	Link    P2PLink
+	Routing P2PRouting
+	// RedirectedBy are the ports whose ACS settings redirect requests.
+	RedirectedBy []*Node
+}
+
+// ingress is the node through which requests from n enter the switch or
+// multi-function device n shares with its peer, which is the one that
+// decides whether they are redirected. It is nil if n is the common
+// ancestor itself, in which case its requests don't enter through a port.
+func ingress(n *Node, common *Node) *Node {
+	if n == common {
+		return nil
+	}
+	for n.Parent != common {
+		n = n.Parent
+	}
+	return n
+}
+
+// NewP2PReadiness determines whether requests between a and b are routed
+// directly or redirected to the root complex by ACS.
+func NewP2PReadiness(a *Node, b *Node) P2PReadiness {
+	r := P2PReadiness{A: a, B: b, Link: P2PPath(a, b)}
+	if r.Link != P2PSingleBridge && r.Link != P2PMultipleBridges {
+		r.Routing = P2PRootComplex
+		return r
+	}
+	common := CommonAncestor(a, b)
+	r.Routing = P2PDirect
+	for _, port := range []*Node{ingress(a, common), ingress(b, common)} {
+		switch {
+		case port == nil:
+		case port.Detail.Config == nil:
+			r.Routing = P2PUnknown
+		case port.RedirectsP2P():
+			r.RedirectedBy = append(r.RedirectedBy, port)
+		}
+	}
+	if len(r.RedirectedBy) > 0 {
+		r.Routing = P2PRedirected
+	}
+	return r
+}
+
+func (r P2PReadiness) String() string {
+	s := fmt.Sprintf("%s <-> %s  %-4s  %s", r.A.Detail.Businfo, r.B.Detail.Businfo, r.Link, r.Routing)
+	if len(r.RedirectedBy) > 0 {
+		ports := []string{}
+		for _, port := range r.RedirectedBy {
+			ports = append(ports, port.Detail.Businfo)
+		}
+		s += " by ACS at " + strings.Join(ports, ", ")
+	}
+	return s
+}
+
+// CheckP2P determines the routing between every pair of devices.
+func CheckP2P(devices []*Node) []P2PReadiness {
+	results := []P2PReadiness{}
+	for i, a := range devices {
+		for _, b := range devices[i+1:] {
+			results = append(results, NewP2PReadiness(a, b))
+		}
+	}
+	return results
+}
+
+// P2PReadinessReport lists the routing of every pair, followed by a
+// summary.
+func P2PReadinessReport(results []P2PReadiness) string {
+	if len(results) == 0 {
+		return "Fewer than two devices selected\n"
+	}
+	var b strings.Builder
+	counts := map[P2PRouting]int{}
+	for _, r := range results {
+		fmt.Fprintln(&b, r)
+		counts[r.Routing]++
+	}
+	fmt.Fprintf(&b, "%d pairs: %d direct, %d redirected by ACS, %d through the root complex, %d unknown\n",
+		len(results), counts[P2PDirect], counts[P2PRedirected], counts[P2PRootComplex], counts[P2PUnknown])
+	return b.String()
+}
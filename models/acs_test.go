@@ -0,0 +1,63 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/LandonTClipp/pciex/pcie"
+)
+
+// addDevice adds a device with the given address and class under parent.
+// Bridges get a PCIBUS handle so that their kind is inferred as one.
+func addDevice(parent *Node, address string, class string) *Node {
+	detail := pcie.Details{Businfo: "pci@" + address, Class: class, Handle: "PCI:" + address}
+	if class == "bridge" {
+		detail.Handle = "PCIBUS:" + address
+	}
+	return parent.AddChild(detail.String(), detail)
+}
+
+func TestNewP2PReadinessPhysicalFunctionAncestor(t *testing.T) {
+	tree := NewTreeModel()
+	tree.Root = NewNode("root", pcie.Details{}, nil, tree)
+	rc := tree.Root.AddChild("rc", pcie.Details{Class: "bridge", Handle: "PCIBUS:0000:00"})
+	rp := addDevice(rc, "0000:00:01.0", "bridge")
+	pf := addDevice(rp, "0000:01:00.0", "network")
+	// Trees built from older snapshots or unusual lshw output can have a
+	// device behind an endpoint.
+	vf := addDevice(pf, "0000:01:00.1", "network")
+
+	r := NewP2PReadiness(pf, vf)
+	if r.Link != P2PSingleBridge {
+		t.Errorf("Link = %s, want %s", r.Link, P2PSingleBridge)
+	}
+	// Only the VF's side enters through a port, and its config wasn't read.
+	if r.Routing != P2PUnknown {
+		t.Errorf("Routing = %s, want %s", r.Routing, P2PUnknown)
+	}
+	if got := len(CheckP2P([]*Node{pf, vf})); got != 1 {
+		t.Errorf("CheckP2P returned %d pairs, want 1", got)
+	}
+}
+
+func TestCheckP2PDefaultDevices(t *testing.T) {
+	tree, rp, _, _ := newSRIOVTree()
+	for _, address := range []string{"0000:01:01.0", "0000:01:02.0", "0000:01:03.0"} {
+		addDevice(rp, address, "display")
+	}
+
+	// The PF and the three GPUs, but none of the VFs.
+	results := CheckP2P(P2PDevices(tree.Root, nil))
+	if len(results) != 6 {
+		t.Fatalf("CheckP2P returned %d pairs, want 6", len(results))
+	}
+	for _, r := range results {
+		if r.A.IsVirtualFunction() || r.B.IsVirtualFunction() {
+			t.Errorf("pair %s includes a virtual function", r)
+		}
+	}
+	lines := strings.Split(strings.TrimSpace(P2PReadinessReport(results)), "\n")
+	if summary := lines[len(lines)-1]; !strings.HasPrefix(summary, "6 pairs: ") {
+		t.Errorf("summary = %q, want 6 pairs", summary)
+	}
+}
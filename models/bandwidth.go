@@ -0,0 +1,123 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Oversubscription compares the bandwidth of a switch's or bridge's
+// upstream link with the sum of the bandwidth of the links below it.
+type Oversubscription struct {
+	Node *Node
+	// Upstream is the bandwidth of the upstream link in GB/s.
+	Upstream float64
+	// Downstream is the total bandwidth of the downstream links in GB/s.
+	Downstream float64
+	// Ports is the number of downstream links that are up.
+	Ports int
+}
+
+// Ratio is the downstream bandwidth divided by the upstream bandwidth.
+// Ratios above 1 mean the devices below can't all run at full speed at
+// once.
+func (o Oversubscription) Ratio() float64 {
+	return o.Downstream / o.Upstream
+}
+
+func (o Oversubscription) Oversubscribed() bool {
+	return o.Ratio() > 1
+}
+
+// links describes the number of downstream links.
+func (o Oversubscription) links() string {
+	if o.Ports == 1 {
+		return "1 link"
+	}
+	return fmt.Sprintf("%d links", o.Ports)
+}
+
+func (o Oversubscription) String() string {
+	s := fmt.Sprintf("Uplink %.1f GB/s, %s downstream %.1f GB/s, ratio %.2f:1",
+		o.Upstream, o.links(), o.Downstream, o.Ratio())
+	if o.Oversubscribed() {
+		s += " (oversubscribed)"
+	}
+	return s
+}
+
+// downstreamBandwidth is the bandwidth of the link below a port. Downstream
+// ports report the link below them, and the devices below report the same
+// link, which is used if the port's own status isn't known.
+func downstreamBandwidth(port *Node) float64 {
+	if port.Detail.Link.Up() {
+		return port.Detail.Link.Bandwidth()
+	}
+	if port.Kind() == KindSwitchDownstream {
+		for _, child := range port.children {
+			if child.Detail.Link.Up() {
+				return child.Detail.Link.Bandwidth()
+			}
+		}
+	}
+	return 0
+}
+
+// Oversubscription returns the bandwidth analysis of a switch upstream port
+// or bridge, or nil if the node is neither or its upstream link isn't up.
+func (n *Node) Oversubscription() *Oversubscription {
+	switch n.Kind() {
+	case KindSwitchUpstream, KindBridge:
+	default:
+		return nil
+	}
+	if !n.Detail.Link.Up() {
+		return nil
+	}
+	o := &Oversubscription{Node: n, Upstream: n.Detail.Link.Bandwidth()}
+	for _, child := range n.children {
+		if bandwidth := downstreamBandwidth(child); bandwidth > 0 {
+			o.Downstream += bandwidth
+			o.Ports++
+		}
+	}
+	if o.Ports == 0 {
+		return nil
+	}
+	return o
+}
+
+// AnalyzeBandwidth returns the oversubscription of every switch and bridge
+// under root, in the order they are displayed.
+func AnalyzeBandwidth(root *Node) []Oversubscription {
+	results := []Oversubscription{}
+	root.Walk(func(n *Node) bool {
+		if o := n.Oversubscription(); o != nil {
+			results = append(results, *o)
+		}
+		return true
+	})
+	return results
+}
+
+// BandwidthReport renders the results of AnalyzeBandwidth as a table.
+func BandwidthReport(results []Oversubscription) string {
+	if len(results) == 0 {
+		return "No switches or bridges with known link speeds\n"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-18s  %-22s  %-26s  %-22s  %s\n", "DEVICE", "KIND", "UPLINK", "DOWNSTREAM", "RATIO")
+	oversubscribed := 0
+	for _, o := range results {
+		l := o.Node.Detail.Link
+		uplink := fmt.Sprintf("%s x%d %.1f GB/s", l.CurrentSpeed, l.CurrentWidth, o.Upstream)
+		downstream := fmt.Sprintf("%s %.1f GB/s", o.links(), o.Downstream)
+		ratio := fmt.Sprintf("%.2f:1", o.Ratio())
+		if o.Oversubscribed() {
+			ratio += " oversubscribed"
+			oversubscribed++
+		}
+		fmt.Fprintf(&b, "%-18s  %-22s  %-26s  %-22s  %s\n", o.Node.Detail.Businfo, o.Node.Kind(), uplink, downstream, ratio)
+	}
+	fmt.Fprintf(&b, "%d of %d switches and bridges are oversubscribed\n", oversubscribed, len(results))
+	return b.String()
+}
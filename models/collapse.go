@@ -0,0 +1,126 @@
+package models
+
+// Depth is the number of levels n is shown below the root in the tree view,
+// where virtual functions are one level below their physical function. Root
+// complexes have a depth of 1.
+func (n *Node) Depth() int {
+	depth := 0
+	for p := n.viewParent(); p != nil; p = p.viewParent() {
+		depth++
+	}
+	return depth
+}
+
+// viewParent is the node n is shown under in the tree view. It is the same
+// as Parent except for virtual functions, which are shown under their
+// physical function.
+func (n *Node) viewParent() *Node {
+	if n.physFn != nil {
+		return n.physFn
+	}
+	return n.Parent
+}
+
+// viewChildren returns the nodes shown under n in the tree view, hidden or
+// not.
+func (n *Node) viewChildren() Children {
+	children := Children{}
+	for _, child := range n.children {
+		if child.physFn == nil {
+			children = append(children, child)
+		}
+	}
+	return append(children, n.vfs...)
+}
+
+// walkView is like Walk, but visits the nodes in the order the tree view
+// shows them.
+func (n *Node) walkView(fn func(*Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, child := range n.viewChildren() {
+		child.walkView(fn)
+	}
+}
+
+// Collapsed reports whether the node's children are hidden.
+func (n *Node) Collapsed() bool {
+	return n.collapsed
+}
+
+// SetCollapsed hides or shows the node's children. Nodes without children
+// can't be collapsed.
+func (n *Node) SetCollapsed(collapsed bool) {
+	n.collapsed = collapsed && len(n.viewChildren()) > 0
+}
+
+// visibleChildren returns the children of n that aren't hidden.
+func (n *Node) visibleChildren() Children {
+	visible := Children{}
+	if n.collapsed {
+		return visible
+	}
+	for _, child := range n.viewChildren() {
+		if !child.Hidden() {
+			visible = append(visible, child)
+		}
+	}
+	return visible
+}
+
+// CollapseAll collapses every node, leaving only the root complexes
+// visible.
+func (m *TreeModel) CollapseAll() {
+	m.ExpandToDepth(1)
+}
+
+// ExpandAll expands every node.
+func (m *TreeModel) ExpandAll() {
+	m.ExpandToDepth(-1)
+}
+
+// ExpandToDepth expands the nodes less than depth levels below the root and
+// collapses the rest, so that nodes up to depth are visible. A negative
+// depth expands every node.
+func (m *TreeModel) ExpandToDepth(depth int) {
+	m.Root.walkView(func(n *Node) bool {
+		n.SetCollapsed(depth >= 0 && n.Depth() >= depth)
+		return true
+	})
+	m.revealSelection()
+}
+
+// ExpandPath expands every ancestor of n so that it is visible.
+func (m *TreeModel) ExpandPath(n *Node) {
+	for p := n.viewParent(); p != nil; p = p.viewParent() {
+		p.SetCollapsed(false)
+	}
+}
+
+// FocusSelection collapses every node other than the ones on the path to
+// the selection.
+func (m *TreeModel) FocusSelection() {
+	selected := m.CurNode
+	m.CollapseAll()
+	m.ExpandPath(selected)
+	m.CurNode = selected
+}
+
+// ToggleCollapsed collapses the selected node if it is expanded, and
+// expands it otherwise.
+func (m *TreeModel) ToggleCollapsed() {
+	if m.CurNode == m.Root {
+		// The root is only selected when nothing else is shown.
+		return
+	}
+	m.CurNode.SetCollapsed(!m.CurNode.collapsed)
+}
+
+// revealSelection moves the selection to its closest visible ancestor if it
+// was hidden.
+func (m *TreeModel) revealSelection() {
+	for m.CurNode != nil && m.CurNode.Hidden() && m.CurNode.viewParent() != nil && m.CurNode.viewParent().Parent != nil {
+		m.CurNode = m.CurNode.viewParent()
+	}
+}
@@ -0,0 +1,175 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type ChangeKind string
+
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeRemoved ChangeKind = "removed"
+	ChangeMoved   ChangeKind = "moved"
+	ChangeLink    ChangeKind = "link"
+	ChangeNUMA    ChangeKind = "numa"
+	ChangeDriver  ChangeKind = "driver"
+)
+
+// Change is a difference of a single device between two topologies.
+type Change struct {
+	Kind    ChangeKind `json:"kind" yaml:"kind"`
+	Businfo string     `json:"businfo" yaml:"businfo"`
+	Name    string     `json:"name" yaml:"name"`
+	Before  string     `json:"before,omitempty" yaml:"before,omitempty"`
+	After   string     `json:"after,omitempty" yaml:"after,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("+ %s %s", c.Businfo, c.Name)
+	case ChangeRemoved:
+		return fmt.Sprintf("- %s %s", c.Businfo, c.Name)
+	default:
+		return fmt.Sprintf("~ %s %s: %s: %s -> %s", c.Businfo, c.Name, c.Kind, c.Before, c.After)
+	}
+}
+
+// indexByBusinfo returns every node under root that has a bus address.
+func indexByBusinfo(root *Node) map[string]*Node {
+	index := map[string]*Node{}
+	root.Walk(func(n *Node) bool {
+		if n.Detail.Businfo != "" {
+			index[n.Detail.Businfo] = n
+		}
+		return true
+	})
+	return index
+}
+
+// parentKey identifies the bridge a node sits behind. Bridges are identified
+// by the bus they forward to, which is the same regardless of whether the
+// tree came from lshw or sysfs.
+func parentKey(n *Node) string {
+	p := n.Parent
+	if p == nil || p.Parent == nil {
+		return ""
+	}
+	if strings.HasPrefix(p.Detail.Handle, "PCIBUS:") {
+		return p.Detail.Handle
+	}
+	return p.Detail.Businfo
+}
+
+func valueOrUnknown(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+func numaString(n *Node) string {
+	if n.Detail.NumaNode == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%d", *n.Detail.NumaNode)
+}
+
+func linkString(n *Node) string {
+	l := n.Detail.Link
+	if l == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%s x%d", l.CurrentSpeed, l.CurrentWidth)
+}
+
+// Diff compares two topologies, matching devices by Businfo. The changes
+// are sorted by Businfo.
+func Diff(before *Node, after *Node) []Change {
+	changes := []Change{}
+	beforeIndex := indexByBusinfo(before)
+	afterIndex := indexByBusinfo(after)
+
+	for businfo, b := range beforeIndex {
+		a, ok := afterIndex[businfo]
+		if !ok {
+			changes = append(changes, Change{Kind: ChangeRemoved, Businfo: businfo, Name: b.Name})
+			continue
+		}
+		for _, compare := range []struct {
+			kind ChangeKind
+			get  func(*Node) string
+		}{
+			{ChangeMoved, func(n *Node) string { return valueOrUnknown(parentKey(n)) }},
+			{ChangeLink, linkString},
+			{ChangeNUMA, numaString},
+			{ChangeDriver, func(n *Node) string { return valueOrUnknown(n.Detail.Driver()) }},
+		} {
+			if bv, av := compare.get(b), compare.get(a); bv != av {
+				changes = append(changes, Change{
+					Kind:    compare.kind,
+					Businfo: businfo,
+					Name:    a.Name,
+					Before:  bv,
+					After:   av,
+				})
+			}
+		}
+	}
+	for businfo, a := range afterIndex {
+		if _, ok := beforeIndex[businfo]; !ok {
+			changes = append(changes, Change{Kind: ChangeAdded, Businfo: businfo, Name: a.Name})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Businfo < changes[j].Businfo
+	})
+	return changes
+}
+
+// ApplyDiff annotates the tree, which must be the "after" side of changes,
+// with the kinds of change of each node. Removed devices are grafted back
+// under their old parent, or the root if that is gone too, so they can be
+// displayed.
+func (m *TreeModel) ApplyDiff(before *Node, changes []Change) {
+	index := indexByBusinfo(m.Root)
+	bridges := map[string]*Node{}
+	m.Root.Walk(func(n *Node) bool {
+		if strings.HasPrefix(n.Detail.Handle, "PCIBUS:") {
+			bridges[n.Detail.Handle] = n
+		}
+		return true
+	})
+	byKind := map[string][]ChangeKind{}
+	for _, c := range changes {
+		byKind[c.Businfo] = append(byKind[c.Businfo], c.Kind)
+	}
+
+	// Walk the old tree so removed parents are grafted before their
+	// children.
+	before.Walk(func(b *Node) bool {
+		if b.Parent == nil || b.Detail.Businfo == "" {
+			return true
+		}
+		if _, ok := index[b.Detail.Businfo]; ok {
+			return true
+		}
+		parent := m.Root
+		if p, ok := index[b.Parent.Detail.Businfo]; ok {
+			parent = p
+		} else if p, ok := bridges[b.Parent.Detail.Handle]; ok {
+			parent = p
+		}
+		index[b.Detail.Businfo] = parent.AddChild(b.Name, b.Detail)
+		return true
+	})
+
+	for businfo, kinds := range byKind {
+		if n, ok := index[businfo]; ok {
+			n.Changes = kinds
+		}
+	}
+}
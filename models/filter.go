@@ -0,0 +1,594 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/LandonTClipp/pciex/pcie"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Filter is a parsed filter expression. Expressions compare fields of a
+// device against values and combine the comparisons with &&, || and !:
+//
+//	class=display && numa=1
+//	vendor~Mellanox
+//	link.downgraded || link.width<16
+//	!(driver=nvidia) && class=display
+//
+// = and != compare case-insensitively, ~ and !~ match a case-insensitive
+// regular expression, and <, <=, > and >= compare numbers. A field on its
+// own is true if it is set, or for flags such as link.downgraded, if the flag
+// is true. Values that contain spaces, operators, parentheses or | are
+// quoted with " or '.
+type Filter struct {
+	expr filterExpr
+	text string
+}
+
+func (f *Filter) String() string {
+	return f.text
+}
+
+// Matches reports whether the node matches the filter. Nodes without a bus
+// address, such as the root complexes of the sysfs collector, never match.
+func (f *Filter) Matches(n *Node) bool {
+	if n.Detail.Businfo == "" {
+		return false
+	}
+	return f.expr.eval(n)
+}
+
+// filterField is a field that can be used in a filter. Exactly one of str,
+// num and flag is set.
+type filterField struct {
+	str  func(n *Node) string
+	num  func(n *Node) (int, bool)
+	flag func(n *Node) bool
+}
+
+func linkNum(get func(n *Node) int) func(n *Node) (int, bool) {
+	return func(n *Node) (int, bool) {
+		if n.Detail.Link == nil {
+			return 0, false
+		}
+		return get(n), true
+	}
+}
+
+func idString(id *pcie.ID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+var filterFields = map[string]filterField{
+	"businfo":     {str: func(n *Node) string { return n.Detail.Businfo }},
+	"class":       {str: func(n *Node) string { return n.Detail.Class }},
+	"vendor":      {str: func(n *Node) string { return n.Detail.Vendor }},
+	"product":     {str: func(n *Node) string { return n.Detail.Product }},
+	"description": {str: func(n *Node) string { return n.Detail.Description }},
+	"driver":      {str: func(n *Node) string { return n.Detail.Driver() }},
+	"kind":        {str: func(n *Node) string { return string(n.Kind()) }},
+	"vendor_id":   {str: func(n *Node) string { return idString(n.Detail.VendorID) }},
+	"device_id":   {str: func(n *Node) string { return idString(n.Detail.DeviceID) }},
+	"cpus":        {str: func(n *Node) string { return valueOf(n.Detail.LocalCPUList) }},
+	"numa": {num: func(n *Node) (int, bool) {
+		if n.Detail.NumaNode == nil || *n.Detail.NumaNode < 0 {
+			return 0, false
+		}
+		return *n.Detail.NumaNode, true
+	}},
+	"iommu_group": {num: func(n *Node) (int, bool) {
+		if n.Detail.IOMMUGroup == nil {
+			return 0, false
+		}
+		return *n.Detail.IOMMUGroup, true
+	}},
+	"link.gen":       {num: linkNum(func(n *Node) int { return n.Detail.Link.CurrentSpeed.Gen() })},
+	"link.width":     {num: linkNum(func(n *Node) int { return n.Detail.Link.CurrentWidth })},
+	"link.max_gen":   {num: linkNum(func(n *Node) int { return n.Detail.Link.MaxSpeed.Gen() })},
+	"link.max_width": {num: linkNum(func(n *Node) int { return n.Detail.Link.MaxWidth })},
+	"link.up":        {flag: func(n *Node) bool { return n.Detail.Link.Up() }},
+	"acs.redirect":   {flag: func(n *Node) bool { return n.RedirectsP2P() }},
+	"vf":             {flag: func(n *Node) bool { return n.IsVirtualFunction() }},
+	"sriov.num_vfs": {num: func(n *Node) (int, bool) {
+		if n.Detail.SRIOV == nil {
+			return 0, false
+		}
+		return n.Detail.SRIOV.NumVFs, true
+	}},
+	"sriov.total_vfs": {num: func(n *Node) (int, bool) {
+		if n.Detail.SRIOV == nil {
+			return 0, false
+		}
+		return n.Detail.SRIOV.TotalVFs, true
+	}},
+	"link.downgraded": {flag: func(n *Node) bool {
+		return n.Detail.Link.Downtrained()
+	}},
+	"driver_override": {str: func(n *Node) string { return driverBinding(n).Override }},
+	"module":          {str: func(n *Node) string { return driverBinding(n).Module }},
+	"modules": {str: func(n *Node) string {
+		return strings.Join(driverBinding(n).CandidateModules, " ")
+	}},
+	"aer":             {flag: func(n *Node) bool { return n.Detail.AER.HasErrors() }},
+	"aer.correctable": {num: aerNum(func(c *pcie.AERCounters) *pcie.AERErrors { return c.Correctable })},
+	"aer.nonfatal":    {num: aerNum(func(c *pcie.AERCounters) *pcie.AERErrors { return c.NonFatal })},
+	"aer.fatal":       {num: aerNum(func(c *pcie.AERCounters) *pcie.AERErrors { return c.Fatal })},
+}
+
+// aerNum is the total of one severity of the node's AER counters.
+func aerNum(get func(c *pcie.AERCounters) *pcie.AERErrors) func(n *Node) (int, bool) {
+	return func(n *Node) (int, bool) {
+		if n.Detail.AER == nil || get(n.Detail.AER) == nil {
+			return 0, false
+		}
+		return int(get(n.Detail.AER).Total), true
+	}
+}
+
+// driverBinding returns the node's driver binding, or an empty one if it
+// wasn't read.
+func driverBinding(n *Node) pcie.DriverBinding {
+	if n.Detail.DriverBinding == nil {
+		return pcie.DriverBinding{}
+	}
+	return *n.Detail.DriverBinding
+}
+
+func valueOf(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+type filterExpr interface {
+	eval(n *Node) bool
+}
+
+type andExpr struct{ left, right filterExpr }
+type orExpr struct{ left, right filterExpr }
+type notExpr struct{ expr filterExpr }
+
+func (e andExpr) eval(n *Node) bool { return e.left.eval(n) && e.right.eval(n) }
+func (e orExpr) eval(n *Node) bool  { return e.left.eval(n) || e.right.eval(n) }
+func (e notExpr) eval(n *Node) bool { return !e.expr.eval(n) }
+
+// compareExpr compares a field with a value. op is empty for a field on its
+// own.
+type compareExpr struct {
+	field filterField
+	op    string
+	value string
+	num   int
+	re    *regexp.Regexp
+}
+
+func (e compareExpr) eval(n *Node) bool {
+	switch {
+	case e.field.flag != nil:
+		v := e.field.flag(n)
+		switch e.op {
+		case "":
+			return v
+		case "=":
+			return v == (e.num != 0)
+		default:
+			return v != (e.num != 0)
+		}
+	case e.field.num != nil:
+		v, ok := e.field.num(n)
+		if !ok {
+			return false
+		}
+		switch e.op {
+		case "":
+			return true
+		case "=":
+			return v == e.num
+		case "!=":
+			return v != e.num
+		case "<":
+			return v < e.num
+		case "<=":
+			return v <= e.num
+		case ">":
+			return v > e.num
+		default:
+			return v >= e.num
+		}
+	default:
+		v := e.field.str(n)
+		switch e.op {
+		case "":
+			return v != ""
+		case "=":
+			return strings.EqualFold(v, e.value)
+		case "!=":
+			return !strings.EqualFold(v, e.value)
+		case "~":
+			return e.re.MatchString(v)
+		default:
+			return !e.re.MatchString(v)
+		}
+	}
+}
+
+type filterToken struct {
+	kind  string // "word", "end" or the operator itself
+	value string
+	// pos is the 1-based position of the token in the filter, counted in
+	// characters.
+	pos int
+}
+
+var filterOps = []string{"&&", "||", "!=", "!~", "<=", ">=", "=", "~", "<", ">", "!", "(", ")"}
+
+// isFilterWordRune reports whether r can appear in an unquoted field or
+// value. Regular expression metacharacters that aren't operators are
+// allowed, so that only expressions with (, ), | or spaces need quoting.
+func isFilterWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._-:@/*+^$[]?{}\\,", r)
+}
+
+func lexFilter(s string) ([]filterToken, error) {
+	tokens := []filterToken{}
+	for i, pos := 0, 1; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+			pos++
+		case r == '"' || r == '\'':
+			end := strings.IndexRune(s[i+size:], r)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", pos)
+			}
+			value := s[i+size : i+size+end]
+			tokens = append(tokens, filterToken{kind: "word", value: value, pos: pos})
+			i += 2*size + end
+			pos += utf8.RuneCountInString(value) + 2
+		case isFilterWordRune(r):
+			start, startPos := i, pos
+			for i < len(s) {
+				r, size := utf8.DecodeRuneInString(s[i:])
+				if !isFilterWordRune(r) {
+					break
+				}
+				i += size
+				pos++
+			}
+			tokens = append(tokens, filterToken{kind: "word", value: s[start:i], pos: startPos})
+		default:
+			matched := false
+			for _, op := range filterOps {
+				if strings.HasPrefix(s[i:], op) {
+					tokens = append(tokens, filterToken{kind: op, value: op, pos: pos})
+					i += len(op)
+					pos += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected %q at %d, quote values that contain it", r, pos)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+	// end is the position just past the end of the filter.
+	end int
+}
+
+func (p *filterParser) peek() filterToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return filterToken{kind: "end", pos: p.end}
+}
+
+func (p *filterParser) next() filterToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *filterParser) parseOr() (filterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == "&&" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterExpr, error) {
+	switch t := p.next(); t.kind {
+	case "!":
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr}, nil
+	case "(":
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != ")" {
+			return nil, fmt.Errorf("expected ) at %d", t.pos)
+		}
+		return expr, nil
+	case "word":
+		return p.parseComparison(t)
+	case "end":
+		return nil, errors.New("unexpected end of filter")
+	default:
+		return nil, fmt.Errorf("unexpected %q at %d", t.value, t.pos)
+	}
+}
+
+func (p *filterParser) parseComparison(name filterToken) (filterExpr, error) {
+	field, ok := filterFields[strings.ToLower(name.value)]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q at %d", name.value, name.pos)
+	}
+	expr := compareExpr{field: field}
+	switch p.peek().kind {
+	case "=", "!=", "~", "!~", "<", "<=", ">", ">=":
+		expr.op = p.next().kind
+	default:
+		return expr, nil
+	}
+	value := p.next()
+	if value.kind != "word" {
+		return nil, fmt.Errorf("expected a value after %s%s at %d", name.value, expr.op, value.pos)
+	}
+	expr.value = value.value
+
+	switch {
+	case field.flag != nil:
+		if expr.op != "=" && expr.op != "!=" {
+			return nil, fmt.Errorf("%s can only be compared with = and !=", name.value)
+		}
+		b, err := strconv.ParseBool(value.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be compared with true or false", name.value)
+		}
+		if b {
+			expr.num = 1
+		}
+	case field.num != nil:
+		if expr.op == "~" || expr.op == "!~" {
+			return nil, fmt.Errorf("%s can't be matched with %s", name.value, expr.op)
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(value.value), "gen"))
+		if err != nil {
+			return nil, fmt.Errorf("%s must be compared with a number", name.value)
+		}
+		expr.num = n
+	default:
+		switch expr.op {
+		case "~", "!~":
+			re, err := regexp.Compile("(?i)" + value.value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression %q: %w", value.value, err)
+			}
+			expr.re = re
+		case "=", "!=":
+		default:
+			return nil, fmt.Errorf("%s can't be compared with %s", name.value, expr.op)
+		}
+	}
+	return expr, nil
+}
+
+// ParseFilter parses a filter expression.
+func ParseFilter(s string) (*Filter, error) {
+	tokens, err := lexFilter(s)
+	if err != nil {
+		return nil, fmt.Errorf("parsing filter: %w", err)
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("parsing filter: filter is empty")
+	}
+	p := &filterParser{tokens: tokens, end: utf8.RuneCountInString(s) + 1}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("parsing filter: %w", err)
+	}
+	if t := p.peek(); t.kind != "end" {
+		return nil, fmt.Errorf("parsing filter: unexpected %q at %d", t.value, t.pos)
+	}
+	return &Filter{expr: expr, text: s}, nil
+}
+
+// SetFilter hides every node that doesn't match f and isn't an ancestor of
+// a node that does. A nil filter shows every node again.
+func (m *TreeModel) SetFilter(f *Filter) {
+	m.filter = f
+	m.filterBar.input.SetValue("")
+	if f != nil {
+		m.filterBar.input.SetValue(f.String())
+	}
+	m.refilter()
+	m.pruneSearch()
+	m.revealSelection()
+	if m.CurNode != nil && (m.CurNode == m.Root || m.CurNode.Hidden()) {
+		m.CurNode = m.firstVisible()
+		if matches := m.FilterMatches(); len(matches) > 0 {
+			m.CurNode = matches[0]
+		}
+	}
+}
+
+// Filter returns the active filter, or nil if there isn't one.
+func (m *TreeModel) Filter() *Filter {
+	return m.filter
+}
+
+// refilter recomputes which nodes the filter shows.
+func (m *TreeModel) refilter() {
+	if m.filter == nil {
+		m.shown = nil
+		return
+	}
+	m.shown = map[*Node]bool{}
+	m.Root.Walk(func(n *Node) bool {
+		if !m.filter.Matches(n) {
+			return true
+		}
+		// The tree view needs the physical function of a matching VF, and
+		// exports need its parent.
+		for p := n; p != nil && !m.shown[p]; p = p.viewParent() {
+			m.shown[p] = true
+		}
+		for p := n.Parent; p != nil && !m.shown[p]; p = p.Parent {
+			m.shown[p] = true
+		}
+		return true
+	})
+}
+
+// filteredOut reports whether the active filter hides n.
+func (m *TreeModel) filteredOut(n *Node) bool {
+	return m.shown != nil && !m.shown[n]
+}
+
+// FilterMatches returns the nodes that match the active filter, in the
+// order they are displayed.
+func (m *TreeModel) FilterMatches() []*Node {
+	matches := []*Node{}
+	if m.filter == nil {
+		return matches
+	}
+	m.Root.Walk(func(n *Node) bool {
+		if m.filter.Matches(n) {
+			matches = append(matches, n)
+		}
+		return true
+	})
+	return matches
+}
+
+// Devices returns the nodes that have a PCI address and aren't hidden by
+// the filter, in depth-first order.
+func (m *TreeModel) Devices() []*Node {
+	devices := []*Node{}
+	m.Root.Walk(func(n *Node) bool {
+		if m.filteredOut(n) {
+			return false
+		}
+		if n.Detail.Businfo != "" {
+			devices = append(devices, n)
+		}
+		return true
+	})
+	return devices
+}
+
+// filterBar is the prompt used to edit the tree's filter.
+type filterBar struct {
+	input   textinput.Model
+	editing bool
+	err     error
+}
+
+func newFilterBar() filterBar {
+	input := textinput.New()
+	input.Prompt = "filter: "
+	return filterBar{input: input}
+}
+
+func (m *TreeModel) startFilter() tea.Cmd {
+	b := &m.filterBar
+	b.editing = true
+	b.err = nil
+	b.input.CursorEnd()
+	return b.input.Focus()
+}
+
+func (m *TreeModel) updateFilter(msg tea.KeyMsg) tea.Cmd {
+	b := &m.filterBar
+	switch msg.String() {
+	case "enter":
+		if strings.TrimSpace(b.input.Value()) == "" {
+			m.SetFilter(nil)
+		} else {
+			f, err := ParseFilter(b.input.Value())
+			if err != nil {
+				b.err = err
+				return nil
+			}
+			m.SetFilter(f)
+		}
+		b.editing = false
+		b.err = nil
+		b.input.Blur()
+		return nil
+	case "esc", "ctrl+c":
+		b.editing = false
+		b.err = nil
+		b.input.Blur()
+		b.input.SetValue("")
+		if m.filter != nil {
+			b.input.SetValue(m.filter.String())
+		}
+		return nil
+	}
+	var cmd tea.Cmd
+	b.input, cmd = b.input.Update(msg)
+	return cmd
+}
+
+// FilterView is the filter prompt while the filter is edited, or the
+// active filter and its number of matches.
+func (m *TreeModel) FilterView() string {
+	b := m.filterBar
+	switch {
+	case b.err != nil:
+		return b.input.View() + "  " + b.err.Error()
+	case b.editing:
+		return b.input.View()
+	case m.filter != nil:
+		return fmt.Sprintf("filter: %s  %d matches", m.filter, len(m.FilterMatches()))
+	}
+	return ""
+}
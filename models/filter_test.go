@@ -0,0 +1,129 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/LandonTClipp/pciex/pcie"
+)
+
+// newFilterTree builds a GPU, a NIC whose link trained below its maximum
+// and a storage controller with a non-ASCII vendor.
+func newFilterTree() *TreeModel {
+	tree := NewTreeModel()
+	tree.Root = NewNode("root", pcie.Details{}, nil, tree)
+	rc := tree.Root.AddChild("rc", pcie.Details{Class: "bridge", Handle: "PCIBUS:0000:00"})
+	for _, d := range []struct {
+		address string
+		class   string
+		vendor  string
+		numa    int
+		link    *pcie.LinkStatus
+	}{
+		{"0000:01:00.0", "display", "NVIDIA Corporation", 0, &pcie.LinkStatus{CurrentSpeed: 4, CurrentWidth: 16, MaxSpeed: 4, MaxWidth: 16}},
+		{"0000:02:00.0", "network", "Mellanox Technologies", 1, &pcie.LinkStatus{CurrentSpeed: 3, CurrentWidth: 8, MaxSpeed: 4, MaxWidth: 16}},
+		{"0000:03:00.0", "storage", "Société Générale de Stockage", 1, nil},
+	} {
+		n := addDevice(rc, d.address, d.class)
+		n.Detail.Vendor = d.vendor
+		numa := d.numa
+		n.Detail.NumaNode = &numa
+		n.Detail.Link = d.link
+	}
+	return tree
+}
+
+func TestFilterMatches(t *testing.T) {
+	tree := newFilterTree()
+	for _, tt := range []struct {
+		filter string
+		want   []string
+	}{
+		// && binds tighter than ||.
+		{"class=display || class=network && numa=0", []string{"01:00.0"}},
+		{"(class=display || class=network) && numa=1", []string{"02:00.0"}},
+		{"class=storage || class=network && numa=1", []string{"02:00.0", "03:00.0"}},
+
+		{"!class=display", []string{"02:00.0", "03:00.0"}},
+		{"!(class=display || class=network)", []string{"03:00.0"}},
+		{"!!class=display", []string{"01:00.0"}},
+		{"class!=display && class!=storage", []string{"02:00.0"}},
+
+		{"CLASS=Display", []string{"01:00.0"}},
+		{"vendor='mellanox technologies'", []string{"02:00.0"}},
+		{`vendor="Société Générale de Stockage"`, []string{"03:00.0"}},
+		{"vendor=Société", nil},
+		{`vendor="a && b" || class=display`, []string{"01:00.0"}},
+
+		{"vendor~mellanox", []string{"02:00.0"}},
+		{"vendor~Générale", []string{"03:00.0"}},
+		{"vendor~^nvidia", []string{"01:00.0"}},
+		{"vendor~[ab]ge$", []string{"03:00.0"}},
+		{"vendor~'^(nvidia|mellanox)'", []string{"01:00.0", "02:00.0"}},
+		{"vendor!~nvidia", []string{"02:00.0", "03:00.0"}},
+
+		{"numa=1", []string{"02:00.0", "03:00.0"}},
+		{"numa!=1", []string{"01:00.0"}},
+		{"link.gen>=4", []string{"01:00.0"}},
+		{"link.gen>3", []string{"01:00.0"}},
+		{"link.width<16", []string{"02:00.0"}},
+		{"link.width<=16", []string{"01:00.0", "02:00.0"}},
+		{"link.max_gen=gen4", []string{"01:00.0", "02:00.0"}},
+		// Devices without a link don't have any link fields.
+		{"link.gen", []string{"01:00.0", "02:00.0"}},
+		{"link.downgraded", []string{"02:00.0"}},
+		{"link.downgraded=false", []string{"01:00.0", "03:00.0"}},
+		{"class", []string{"01:00.0", "02:00.0", "03:00.0"}},
+	} {
+		t.Run(tt.filter, func(t *testing.T) {
+			f, err := ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, n := range tree.Root.children[0].children {
+				if f.Matches(n) {
+					got = append(got, shortAddress(n))
+				}
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("matched %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, tt := range []struct {
+		filter string
+		want   string
+	}{
+		{"", "filter is empty"},
+		{"class=display &&", "unexpected end of filter"},
+		{"(class=display", "expected ) at 15"},
+		{"class=display)", `unexpected ")" at 14`},
+		{"&& class=display", `unexpected "&&" at 1`},
+		{"bogus=1", `unknown field "bogus" at 1`},
+		{"class=", "expected a value after class= at 7"},
+		{"vendor='x", "unterminated string at 8"},
+		// Positions count characters, not bytes.
+		{"vendor=é && #x", `unexpected '#' at 13, quote values that contain it`},
+		{"vendor~a|b", `unexpected '|' at 9, quote values that contain it`},
+		{"vendor~'['", "invalid regular expression"},
+		{"numa~1", "numa can't be matched with ~"},
+		{"numa=one", "numa must be compared with a number"},
+		{"link.up<1", "link.up can only be compared with = and !="},
+		{"link.up=maybe", "link.up must be compared with true or false"},
+		{"class<3", "class can't be compared with <"},
+	} {
+		t.Run(tt.filter, func(t *testing.T) {
+			_, err := ParseFilter(tt.filter)
+			if err == nil {
+				t.Fatal("parsed without error")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q doesn't contain %q", err, tt.want)
+			}
+		})
+	}
+}
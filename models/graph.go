@@ -0,0 +1,213 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// classColors fill the nodes of a graph by device class.
+var classColors = map[string]string{
+	"bridge":        "#e8e8e8",
+	"display":       "#b7e1a1",
+	"network":       "#a9cce3",
+	"storage":       "#f9e79f",
+	"memory":        "#f5cba7",
+	"processor":     "#d7bde2",
+	"communication": "#aed6f1",
+	"multimedia":    "#fadbd8",
+	"bus":           "#d5dbdb",
+}
+
+const defaultClassColor = "#ffffff"
+
+// numaColors outline the nodes of a graph by NUMA node.
+var numaColors = []string{"#1f77b4", "#d62728", "#2ca02c", "#9467bd", "#ff7f0e", "#8c564b", "#e377c2", "#17becf"}
+
+const unknownNUMAColor = "#7f7f7f"
+
+func classColor(n *Node) string {
+	if color, ok := classColors[n.Detail.Class]; ok {
+		return color
+	}
+	return defaultClassColor
+}
+
+func numaColor(n *Node) string {
+	if n.Detail.NumaNode == nil || *n.Detail.NumaNode < 0 {
+		return unknownNUMAColor
+	}
+	return numaColors[*n.Detail.NumaNode%len(numaColors)]
+}
+
+// edgeLabel describes the link between a node and its parent, such as
+// "Gen4 x16", or "Gen3 x8 of Gen4 x16" if it is downtrained.
+func edgeLabel(n *Node) string {
+	l := n.Detail.Link
+	switch {
+	case l == nil:
+		return ""
+	case !l.Up():
+		return "down"
+	case l.Downtrained():
+		return fmt.Sprintf("Gen%d x%d of Gen%d x%d", l.CurrentSpeed.Gen(), l.CurrentWidth, l.MaxSpeed.Gen(), l.MaxWidth)
+	}
+	return fmt.Sprintf("Gen%d x%d", l.CurrentSpeed.Gen(), l.CurrentWidth)
+}
+
+// graphLabel is the node's label followed by its address.
+func graphLabel(n *Node) string {
+	if address := shortAddress(n); address != "" {
+		return n.Name + "\n" + address
+	}
+	return n.Name
+}
+
+// clusterLabel names the cluster drawn around a bridge or switch port and
+// the devices behind it.
+func clusterLabel(n *Node) string {
+	return strings.TrimSpace(string(n.Kind()) + " " + shortAddress(n))
+}
+
+// graph numbers the nodes the filter leaves in the tree so that writers can
+// refer to them.
+type graph struct {
+	m   *TreeModel
+	ids map[*Node]int
+}
+
+func (m *TreeModel) newGraph() graph {
+	g := graph{m: m, ids: map[*Node]int{}}
+	m.Root.Walk(func(n *Node) bool {
+		if m.filteredOut(n) {
+			return false
+		}
+		g.ids[n] = len(g.ids)
+		return true
+	})
+	return g
+}
+
+// isCluster reports whether n is drawn as a cluster around the devices
+// behind it. Only bridges and switch ports are; root complexes and
+// endpoints with functions behind them are drawn as ordinary nodes.
+func isCluster(n *Node) bool {
+	switch n.Kind() {
+	case KindRootPort, KindSwitchUpstream, KindSwitchDownstream, KindBridge:
+		return true
+	}
+	return false
+}
+
+// children returns the children of n in the graph.
+func (g graph) children(n *Node) []*Node {
+	children := []*Node{}
+	for _, child := range n.children {
+		if !g.m.filteredOut(child) {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WriteDOT writes the tree as a Graphviz graph. Every bridge and switch is
+// drawn as a cluster around the devices behind it, edges are labeled with
+// the link each device trained at, and devices are filled by class and
+// outlined by NUMA node.
+func (m *TreeModel) WriteDOT(w io.Writer) error {
+	g := m.newGraph()
+	var b strings.Builder
+	b.WriteString("digraph pcie {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\", penwidth=2];\n")
+	b.WriteString("  edge [fontname=\"Helvetica\", fontsize=10];\n")
+	for _, n := range g.children(m.Root) {
+		g.writeDOTNode(&b, n, "  ")
+	}
+	m.Root.Walk(func(n *Node) bool {
+		if m.filteredOut(n) {
+			return false
+		}
+		if n.Parent != nil && n.Parent != m.Root {
+			fmt.Fprintf(&b, "  n%d -> n%d", g.ids[n.Parent], g.ids[n])
+			if label := edgeLabel(n); label != "" {
+				fmt.Fprintf(&b, " [label=\"%s\"]", dotEscaper.Replace(label))
+			}
+			b.WriteString(";\n")
+		}
+		return true
+	})
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (g graph) writeDOTNode(b *strings.Builder, n *Node, indent string) {
+	children := g.children(n)
+	if len(children) > 0 && isCluster(n) {
+		fmt.Fprintf(b, "%ssubgraph cluster_%d {\n", indent, g.ids[n])
+		fmt.Fprintf(b, "%s  label=\"%s\";\n", indent, dotEscaper.Replace(clusterLabel(n)))
+		fmt.Fprintf(b, "%s  style=\"rounded,dashed\";\n", indent)
+		defer fmt.Fprintf(b, "%s}\n", indent)
+		indent += "  "
+	}
+	fmt.Fprintf(b, "%sn%d [label=\"%s\", fillcolor=\"%s\", color=\"%s\"];\n",
+		indent, g.ids[n], dotEscaper.Replace(graphLabel(n)), classColor(n), numaColor(n))
+	for _, child := range children {
+		g.writeDOTNode(b, child, indent)
+	}
+}
+
+// mermaidEscaper replaces the characters that can't appear in a quoted
+// Mermaid label with entity codes.
+var mermaidEscaper = strings.NewReplacer(`"`, "#quot;", "\n", "<br/>")
+
+// WriteMermaid writes the tree as a Mermaid flowchart, drawn the same way
+// as WriteDOT.
+func (m *TreeModel) WriteMermaid(w io.Writer) error {
+	g := m.newGraph()
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, n := range g.children(m.Root) {
+		g.writeMermaidNode(&b, n, "  ")
+	}
+	m.Root.Walk(func(n *Node) bool {
+		if m.filteredOut(n) {
+			return false
+		}
+		if n.Parent != nil && n.Parent != m.Root {
+			if label := edgeLabel(n); label != "" {
+				fmt.Fprintf(&b, "  n%d -->|\"%s\"| n%d\n", g.ids[n.Parent], mermaidEscaper.Replace(label), g.ids[n])
+			} else {
+				fmt.Fprintf(&b, "  n%d --> n%d\n", g.ids[n.Parent], g.ids[n])
+			}
+		}
+		return true
+	})
+	m.Root.Walk(func(n *Node) bool {
+		if m.filteredOut(n) {
+			return false
+		}
+		if n != m.Root {
+			fmt.Fprintf(&b, "  style n%d fill:%s,stroke:%s,stroke-width:2px\n", g.ids[n], classColor(n), numaColor(n))
+		}
+		return true
+	})
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (g graph) writeMermaidNode(b *strings.Builder, n *Node, indent string) {
+	children := g.children(n)
+	if len(children) > 0 && isCluster(n) {
+		fmt.Fprintf(b, "%ssubgraph c%d[\"%s\"]\n", indent, g.ids[n], mermaidEscaper.Replace(clusterLabel(n)))
+		defer fmt.Fprintf(b, "%send\n", indent)
+		indent += "  "
+	}
+	fmt.Fprintf(b, "%sn%d[\"%s\"]\n", indent, g.ids[n], mermaidEscaper.Replace(graphLabel(n)))
+	for _, child := range children {
+		g.writeMermaidNode(b, child, indent)
+	}
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/LandonTClipp/pciex/pcie"
+)
+
+// newGraphTree builds a root complex with a switch behind its first root
+// port, with a GPU behind the switch, and a NIC with a second function and
+// a storage controller sharing its second root port.
+func newGraphTree() *TreeModel {
+	tree := NewTreeModel()
+	tree.Root = NewNode("root", pcie.Details{}, nil, tree)
+	rc := tree.Root.AddChild("rc", pcie.Details{Class: "bridge", Handle: "PCIBUS:0000:00"})
+	up := addDevice(addDevice(rc, "0000:00:01.0", "bridge"), "0000:01:00.0", "bridge")
+	gpu := addDevice(addDevice(up, "0000:02:00.0", "bridge"), "0000:03:00.0", "display")
+	gpu.Detail.Link = &pcie.LinkStatus{CurrentSpeed: 3, CurrentWidth: 8, MaxSpeed: 4, MaxWidth: 16}
+	numa := 1
+	gpu.Detail.NumaNode = &numa
+	rp := addDevice(rc, "0000:00:02.0", "bridge")
+	nic := addDevice(rp, "0000:04:00.0", "network")
+	nic.Detail.Link = &pcie.LinkStatus{CurrentSpeed: 4, CurrentWidth: 16, MaxSpeed: 4, MaxWidth: 16}
+	addDevice(nic, "0000:04:00.1", "network")
+	addDevice(rp, "0000:04:01.0", "storage")
+	return tree
+}
+
+func TestWriteDOT(t *testing.T) {
+	var b strings.Builder
+	if err := newGraphTree().WriteDOT(&b); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != wantDOT {
+		t.Errorf("WriteDOT wrote\n%s\nwant\n%s", got, wantDOT)
+	}
+}
+
+func TestWriteMermaid(t *testing.T) {
+	var b strings.Builder
+	if err := newGraphTree().WriteMermaid(&b); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != wantMermaid {
+		t.Errorf("WriteMermaid wrote\n%s\nwant\n%s", got, wantMermaid)
+	}
+}
+
+const wantDOT = `digraph pcie {
+  rankdir=LR;
+  node [shape=box, style="rounded,filled", fontname="Helvetica", penwidth=2];
+  edge [fontname="Helvetica", fontsize=10];
+  n1 [label="rc", fillcolor="#e8e8e8", color="#7f7f7f"];
+  subgraph cluster_2 {
+    label="root port 00:01.0";
+    style="rounded,dashed";
+    n2 [label="bridge | PCIBUS:0000:00:01.0\n00:01.0", fillcolor="#e8e8e8", color="#7f7f7f"];
+    subgraph cluster_3 {
+      label="switch upstream port 01:00.0";
+      style="rounded,dashed";
+      n3 [label="bridge | PCIBUS:0000:01:00.0\n01:00.0", fillcolor="#e8e8e8", color="#7f7f7f"];
+      subgraph cluster_4 {
+        label="switch downstream port 02:00.0";
+        style="rounded,dashed";
+        n4 [label="bridge | PCIBUS:0000:02:00.0\n02:00.0", fillcolor="#e8e8e8", color="#7f7f7f"];
+        n5 [label="display | \n03:00.0", fillcolor="#b7e1a1", color="#d62728"];
+      }
+    }
+  }
+  subgraph cluster_6 {
+    label="root port 00:02.0";
+    style="rounded,dashed";
+    n6 [label="bridge | PCIBUS:0000:00:02.0\n00:02.0", fillcolor="#e8e8e8", color="#7f7f7f"];
+    n7 [label="network | \n04:00.0", fillcolor="#a9cce3", color="#7f7f7f"];
+    n8 [label="network | \n04:00.1", fillcolor="#a9cce3", color="#7f7f7f"];
+    n9 [label="storage | \n04:01.0", fillcolor="#f9e79f", color="#7f7f7f"];
+  }
+  n1 -> n2;
+  n2 -> n3;
+  n3 -> n4;
+  n4 -> n5 [label="Gen3 x8 of Gen4 x16"];
+  n1 -> n6;
+  n6 -> n7 [label="Gen4 x16"];
+  n7 -> n8;
+  n6 -> n9;
+}
+`
+
+const wantMermaid = `flowchart LR
+  n1["rc"]
+  subgraph c2["root port 00:01.0"]
+    n2["bridge | PCIBUS:0000:00:01.0<br/>00:01.0"]
+    subgraph c3["switch upstream port 01:00.0"]
+      n3["bridge | PCIBUS:0000:01:00.0<br/>01:00.0"]
+      subgraph c4["switch downstream port 02:00.0"]
+        n4["bridge | PCIBUS:0000:02:00.0<br/>02:00.0"]
+        n5["display | <br/>03:00.0"]
+      end
+    end
+  end
+  subgraph c6["root port 00:02.0"]
+    n6["bridge | PCIBUS:0000:00:02.0<br/>00:02.0"]
+    n7["network | <br/>04:00.0"]
+    n8["network | <br/>04:00.1"]
+    n9["storage | <br/>04:01.0"]
+  end
+  n1 --> n2
+  n2 --> n3
+  n3 --> n4
+  n4 -->|"Gen3 x8 of Gen4 x16"| n5
+  n1 --> n6
+  n6 -->|"Gen4 x16"| n7
+  n7 --> n8
+  n6 --> n9
+  style n1 fill:#e8e8e8,stroke:#7f7f7f,stroke-width:2px
+  style n2 fill:#e8e8e8,stroke:#7f7f7f,stroke-width:2px
+  style n3 fill:#e8e8e8,stroke:#7f7f7f,stroke-width:2px
+  style n4 fill:#e8e8e8,stroke:#7f7f7f,stroke-width:2px
+  style n5 fill:#b7e1a1,stroke:#d62728,stroke-width:2px
+  style n6 fill:#e8e8e8,stroke:#7f7f7f,stroke-width:2px
+  style n7 fill:#a9cce3,stroke:#7f7f7f,stroke-width:2px
+  style n8 fill:#a9cce3,stroke:#7f7f7f,stroke-width:2px
+  style n9 fill:#f9e79f,stroke:#7f7f7f,stroke-width:2px
+`
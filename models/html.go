@@ -0,0 +1,250 @@
+package models
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// htmlNode is a node of the tree embedded in the HTML report.
+type htmlNode struct {
+	Label     string     `json:"label"`
+	Badges    string     `json:"badges"`
+	Details   string     `json:"details"`
+	Search    []string   `json:"search"`
+	Collapsed bool       `json:"collapsed"`
+	Warning   bool       `json:"warning"`
+	Children  []htmlNode `json:"children"`
+}
+
+func (m *TreeModel) newHTMLNodes(nodes Children) []htmlNode {
+	out := []htmlNode{}
+	for _, n := range nodes {
+		if m.filteredOut(n) {
+			continue
+		}
+		out = append(out, htmlNode{
+			Label: n.Name,
+			// The page draws its own toggle.
+			Badges: strings.TrimSpace(n.badges(false)),
+			// The report has no selection to draw a path to, so the details
+			// are the same as in the explorer without a marked device.
+			Details: n.DetailView(),
+			// The fields MatchesQuery looks at.
+			Search: []string{
+				n.Detail.Businfo,
+				n.Detail.Vendor,
+				n.Detail.Product,
+				n.Detail.Class,
+				n.Detail.Driver(),
+			},
+			Collapsed: n.collapsed,
+			Warning:   n.Detail.Link.Downtrained() || n.Detail.AER.HasErrors(),
+			Children:  m.newHTMLNodes(n.viewChildren()),
+		})
+	}
+	return out
+}
+
+// NUMASummary counts the devices matching the P2P filter on each NUMA node,
+// by class.
+func NUMASummary(devices []*Node) string {
+	byNUMA := map[string]map[string]int{}
+	cpus := map[string]string{}
+	for _, n := range devices {
+		numa := numaString(n)
+		if numa == "none" || numa == "-1" {
+			numa = "unknown"
+		}
+		if byNUMA[numa] == nil {
+			byNUMA[numa] = map[string]int{}
+		}
+		byNUMA[numa][n.Detail.Class]++
+		if n.Detail.LocalCPUList != nil && *n.Detail.LocalCPUList != "" {
+			cpus[numa] = *n.Detail.LocalCPUList
+		}
+	}
+	nodes := []string{}
+	for numa := range byNUMA {
+		nodes = append(nodes, numa)
+	}
+	sort.Strings(nodes)
+
+	var b strings.Builder
+	for _, numa := range nodes {
+		classes := []string{}
+		for class, count := range byNUMA[numa] {
+			classes = append(classes, fmt.Sprintf("%d %s", count, class))
+		}
+		sort.Strings(classes)
+		fmt.Fprintf(&b, "NUMA node %s: %s", numa, strings.Join(classes, ", "))
+		if cpus[numa] != "" {
+			fmt.Fprintf(&b, " (CPUs %s)", cpus[numa])
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+type htmlReport struct {
+	Hostname    string
+	GeneratedAt string
+	Tree        []htmlNode
+	Matrix      string
+	NUMA        string
+}
+
+// WriteHTML writes a single HTML page with no external assets that shows
+// the tree, the details of each device, a search box, and the P2P matrix
+// and NUMA placement of the devices matching DefaultP2PFilter.
+func (m *TreeModel) WriteHTML(w io.Writer) error {
+	devices := []*Node{}
+	for _, n := range P2PDevices(m.Root, nil) {
+		if !m.filteredOut(n) {
+			devices = append(devices, n)
+		}
+	}
+	report := htmlReport{
+		Hostname:    m.Hostname,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Tree:        m.newHTMLNodes(m.Root.children),
+		Matrix:      NewP2PMatrix(devices).String(),
+		NUMA:        NUMASummary(devices),
+	}
+	return htmlTemplate.Execute(w, report)
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>PCIe topology{{if .Hostname}} of {{.Hostname}}{{end}}</title>
+<style>
+body { margin: 0; font-family: sans-serif; color: #222; }
+header { padding: 8px 16px; background: #6124df; color: #fff; display: flex; gap: 16px; align-items: center; }
+header h1 { font-size: 18px; margin: 0; flex: 1; }
+header input { width: 320px; padding: 4px; }
+main { display: flex; height: calc(100vh - 48px); }
+#tree { flex: 1; overflow: auto; padding: 8px 16px; font-family: monospace; }
+#side { flex: 1; overflow: auto; border-left: 1px solid #ccc; padding: 8px 16px; }
+ul { list-style: none; margin: 0; padding-left: 20px; }
+#tree > ul { padding-left: 0; }
+.toggle { display: inline-block; width: 16px; cursor: pointer; color: #888; }
+.label { cursor: pointer; padding: 0 4px; border-radius: 3px; }
+.label:hover { background: #eee; }
+.selected { background: #3f1fa0 !important; color: #fff; }
+.match { background: #ffe680; }
+.warning { color: #c0392b; font-weight: bold; }
+.badges { color: #888; }
+.collapsed > ul { display: none; }
+pre { white-space: pre-wrap; font-size: 12px; }
+h2 { font-size: 15px; }
+</style>
+</head>
+<body>
+<header>
+<h1>PCIe topology{{if .Hostname}} of {{.Hostname}}{{end}} <small>{{.GeneratedAt}}</small></h1>
+<input id="search" type="search" placeholder="Search address, vendor, product, class or driver">
+<span id="count"></span>
+</header>
+<main>
+<div id="tree"></div>
+<div id="side">
+<h2>Details</h2>
+<pre id="details">Select a device.</pre>
+<h2>Peer-to-peer</h2>
+<pre>{{.Matrix}}</pre>
+<h2>NUMA</h2>
+<pre>{{.NUMA}}</pre>
+</div>
+</main>
+<script>
+const tree = {{.Tree}};
+const items = [];
+let selected = null;
+
+function render(nodes) {
+  const ul = document.createElement("ul");
+  for (const node of nodes) {
+    const li = document.createElement("li");
+    const toggle = document.createElement("span");
+    toggle.className = "toggle";
+    const label = document.createElement("span");
+    label.className = "label" + (node.warning ? " warning" : "");
+    label.textContent = node.label;
+    if (node.badges) {
+      const badges = document.createElement("span");
+      badges.className = "badges";
+      badges.textContent = " " + node.badges;
+      label.appendChild(badges);
+    }
+    li.append(toggle, label);
+    const item = {node, li, label};
+    label.onclick = () => select(item);
+    // Items are in the order they are shown, so search steps through
+    // matches from top to bottom.
+    items.push(item);
+    if (node.children && node.children.length > 0) {
+      toggle.textContent = "▾";
+      if (node.collapsed) {
+        li.classList.add("collapsed");
+        toggle.textContent = "▸";
+      }
+      toggle.onclick = () => {
+        li.classList.toggle("collapsed");
+        toggle.textContent = li.classList.contains("collapsed") ? "▸" : "▾";
+      };
+      li.appendChild(render(node.children));
+    }
+    ul.appendChild(li);
+  }
+  return ul;
+}
+
+function select(item) {
+  if (selected) selected.label.classList.remove("selected");
+  selected = item;
+  item.label.classList.add("selected");
+  document.getElementById("details").textContent = item.node.details;
+  for (let li = item.li.parentElement.closest("li"); li; li = li.parentElement.closest("li")) {
+    li.classList.remove("collapsed");
+    li.querySelector(":scope > .toggle").textContent = "▾";
+  }
+  item.label.scrollIntoView({block: "nearest"});
+}
+
+let matches = [];
+let current = -1;
+function search(query) {
+  query = query.toLowerCase();
+  matches = [];
+  current = -1;
+  for (const item of items) {
+    const match = query !== "" && item.node.search.some(f => f.toLowerCase().includes(query));
+    item.label.classList.toggle("match", match);
+    if (match) matches.push(item);
+  }
+  document.getElementById("count").textContent = query === "" ? "" : matches.length === 0 ? "no matches" : matches.length + " matches";
+  next(1);
+}
+
+function next(step) {
+  if (matches.length === 0) return;
+  current = (current + step + matches.length) % matches.length;
+  select(matches[current]);
+  document.getElementById("count").textContent = (current + 1) + "/" + matches.length;
+}
+
+document.getElementById("tree").appendChild(render(tree));
+const input = document.getElementById("search");
+input.oninput = () => search(input.value);
+input.onkeydown = e => {
+  if (e.key === "Enter") next(e.shiftKey ? -1 : 1);
+};
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTMLBadgesLeaveOutCollapsed(t *testing.T) {
+	m := newWatchTree(watchDevice{"0000:01:00.0", "0000:00:01.0", 0})
+	m.Marked = m.Root.FindByAddress("0000:00:01.0")
+	m.Marked.SetCollapsed(true)
+
+	if got := m.Marked.Value(); !strings.Contains(got, " [+1]") {
+		t.Errorf("tree label %q has no count of hidden children", got)
+	}
+	port := m.newHTMLNodes(m.Root.children)[0].Children[0]
+	if port.Badges != "[marked]" {
+		t.Errorf("HTML badges = %q, want [marked]", port.Badges)
+	}
+	if !port.Collapsed || len(port.Children) != 1 {
+		t.Errorf("HTML node collapsed = %v with %d children, want collapsed with 1", port.Collapsed, len(port.Children))
+	}
+}
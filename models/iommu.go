@@ -0,0 +1,88 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// IOMMUGroup is a set of devices the IOMMU can't isolate from each other,
+// so they can only be assigned to a VM together.
+type IOMMUGroup struct {
+	ID      int
+	Devices []*Node
+}
+
+// Endpoints returns the devices of the group that would have to be bound to
+// vfio-pci. Bridges and ports in a group don't need to be passed through.
+// That includes host bridges and other bridges with a type 0 header, which
+// Kind counts as endpoints.
+func (g IOMMUGroup) Endpoints() []*Node {
+	endpoints := []*Node{}
+	for _, n := range g.Devices {
+		if n.Kind() == KindEndpoint && n.Detail.Class != "bridge" {
+			endpoints = append(endpoints, n)
+		}
+	}
+	return endpoints
+}
+
+// Warning explains why the group can't be passed through one device at a
+// time, or is empty if it can.
+func (g IOMMUGroup) Warning() string {
+	endpoints := g.Endpoints()
+	if len(endpoints) <= 1 {
+		return ""
+	}
+	return fmt.Sprintf("%d devices must be passed through together", len(endpoints))
+}
+
+// IOMMUGroups collects the IOMMU groups of the devices under root, sorted by
+// ID.
+func IOMMUGroups(root *Node) []IOMMUGroup {
+	byID := map[int]*IOMMUGroup{}
+	root.Walk(func(n *Node) bool {
+		if n.Detail.IOMMUGroup == nil {
+			return true
+		}
+		id := *n.Detail.IOMMUGroup
+		if byID[id] == nil {
+			byID[id] = &IOMMUGroup{ID: id}
+		}
+		byID[id].Devices = append(byID[id].Devices, n)
+		return true
+	})
+	groups := []IOMMUGroup{}
+	for _, g := range byID {
+		groups = append(groups, *g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].ID < groups[j].ID
+	})
+	return groups
+}
+
+// IOMMUReport lists every group with its devices and warnings.
+func IOMMUReport(groups []IOMMUGroup) string {
+	if len(groups) == 0 {
+		return "No IOMMU groups found. The IOMMU may be disabled; check for intel_iommu=on or amd_iommu=on on the kernel command line.\n"
+	}
+	var b strings.Builder
+	shared := 0
+	for _, g := range groups {
+		fmt.Fprintf(&b, "IOMMU group %d\n", g.ID)
+		for _, n := range g.Devices {
+			driver := n.Detail.Driver()
+			if driver == "" {
+				driver = "no driver"
+			}
+			fmt.Fprintf(&b, "  %-18s  %s (%s)\n", n.Detail.Businfo, n.Name, driver)
+		}
+		if warning := g.Warning(); warning != "" {
+			fmt.Fprintf(&b, "  ! %s\n", warning)
+			shared++
+		}
+	}
+	fmt.Fprintf(&b, "%d of %d groups contain more than one device\n", shared, len(groups))
+	return b.String()
+}
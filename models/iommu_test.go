@@ -0,0 +1,56 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/LandonTClipp/pciex/pcie"
+)
+
+func TestIOMMUGroupEndpoints(t *testing.T) {
+	tree := NewTreeModel()
+	tree.Root = NewNode("root", pcie.Details{}, nil, tree)
+	rc := tree.Root.AddChild("rc", pcie.Details{Class: "bridge", Handle: "PCIBUS:0000:00"})
+	group := func(id int, nodes ...*Node) {
+		for _, n := range nodes {
+			n.Detail.IOMMUGroup = &id
+		}
+	}
+	// A host bridge is a type 0 function, but not an endpoint.
+	hostBridge := addDevice(rc, "0000:00:00.0", "bridge")
+	hostBridge.Detail.Handle = "PCI:0000:00:00.0"
+	nic := addDevice(rc, "0000:00:02.0", "network")
+	group(0, hostBridge, nic)
+
+	rp := addDevice(rc, "0000:00:01.0", "bridge")
+	gpu := addDevice(rp, "0000:01:00.0", "display")
+	audio := addDevice(rp, "0000:01:00.1", "multimedia")
+	group(1, rp, gpu, audio)
+
+	groups := IOMMUGroups(tree.Root)
+	if len(groups) != 2 {
+		t.Fatalf("found %d groups, want 2", len(groups))
+	}
+	for i, tt := range []struct {
+		want    []*Node
+		warning string
+	}{
+		{[]*Node{nic}, ""},
+		{[]*Node{gpu, audio}, "2 devices must be passed through together"},
+	} {
+		g := groups[i]
+		got := g.Endpoints()
+		if len(got) != len(tt.want) {
+			t.Errorf("group %d: endpoints %v, want %v", g.ID, got, tt.want)
+		} else {
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("group %d: endpoints %v, want %v", g.ID, got, tt.want)
+					break
+				}
+			}
+		}
+		if w := g.Warning(); w != tt.warning {
+			t.Errorf("group %d: warning %q, want %q", g.ID, w, tt.warning)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/LandonTClipp/pciex/pcie"
+)
+
+// metricLabel is a label of a sample in addition to the ones identifying
+// the device.
+type metricLabel struct {
+	name  string
+	value string
+}
+
+type metricSample struct {
+	labels []metricLabel
+	value  float64
+}
+
+// metricFamily is a metric exported for every device. samples returns
+// nothing for devices the metric doesn't apply to.
+type metricFamily struct {
+	name    string
+	help    string
+	typ     string
+	samples func(n *Node) []metricSample
+}
+
+func sample(value float64, labels ...metricLabel) []metricSample {
+	return []metricSample{{labels: labels, value: value}}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// linkSample exports a property of the node's link if it is known.
+func linkSample(get func(l *pcie.LinkStatus) float64) func(n *Node) []metricSample {
+	return func(n *Node) []metricSample {
+		if n.Detail.Link == nil {
+			return nil
+		}
+		return sample(get(n.Detail.Link))
+	}
+}
+
+// aerSamples exports one sample per severity.
+func aerSamples(n *Node, get func(c *pcie.AERCounters) [3]*uint64) []metricSample {
+	if n.Detail.AER == nil {
+		return nil
+	}
+	samples := []metricSample{}
+	for i, v := range get(n.Detail.AER) {
+		if v != nil {
+			samples = append(samples, sample(float64(*v), metricLabel{"severity", aerSeverities[i]})...)
+		}
+	}
+	return samples
+}
+
+var aerSeverities = [3]string{"correctable", "nonfatal", "fatal"}
+
+func aerTotal(e *pcie.AERErrors) *uint64 {
+	if e == nil {
+		return nil
+	}
+	return &e.Total
+}
+
+var metricFamilies = []metricFamily{
+	{
+		name: "pciex_device_info",
+		help: "Always 1. Describes the device and the driver bound to it.",
+		typ:  "gauge",
+		samples: func(n *Node) []metricSample {
+			return sample(1,
+				metricLabel{"kind", string(n.Kind())},
+				metricLabel{"driver", n.Detail.Driver()},
+				metricLabel{"vendor_id", idString(n.Detail.VendorID)},
+				metricLabel{"device_id", idString(n.Detail.DeviceID)},
+			)
+		},
+	},
+	{
+		name: "pciex_driver_bound",
+		help: "Whether a driver is bound to the device.",
+		typ:  "gauge",
+		samples: func(n *Node) []metricSample {
+			return sample(boolValue(n.Detail.Driver() != ""))
+		},
+	},
+	{
+		name: "pciex_numa_node",
+		help: "NUMA node the device is attached to.",
+		typ:  "gauge",
+		samples: func(n *Node) []metricSample {
+			if n.Detail.NumaNode == nil || *n.Detail.NumaNode < 0 {
+				return nil
+			}
+			return sample(float64(*n.Detail.NumaNode))
+		},
+	},
+	{
+		name:    "pciex_link_speed_gts",
+		help:    "Speed the link trained at, in GT/s per lane.",
+		typ:     "gauge",
+		samples: linkSample(func(l *pcie.LinkStatus) float64 { return l.CurrentSpeed.GTps() }),
+	},
+	{
+		name:    "pciex_link_max_speed_gts",
+		help:    "Maximum speed of the link, in GT/s per lane.",
+		typ:     "gauge",
+		samples: linkSample(func(l *pcie.LinkStatus) float64 { return l.MaxSpeed.GTps() }),
+	},
+	{
+		name:    "pciex_link_width",
+		help:    "Number of lanes the link trained at.",
+		typ:     "gauge",
+		samples: linkSample(func(l *pcie.LinkStatus) float64 { return float64(l.CurrentWidth) }),
+	},
+	{
+		name:    "pciex_link_max_width",
+		help:    "Maximum number of lanes of the link.",
+		typ:     "gauge",
+		samples: linkSample(func(l *pcie.LinkStatus) float64 { return float64(l.MaxWidth) }),
+	},
+	{
+		name:    "pciex_link_downtrained",
+		help:    "Whether the link trained below its maximum speed or width.",
+		typ:     "gauge",
+		samples: linkSample(func(l *pcie.LinkStatus) float64 { return boolValue(l.Downtrained()) }),
+	},
+	{
+		name: "pciex_aer_errors_total",
+		help: "AER errors reported by the device since boot.",
+		typ:  "counter",
+		samples: func(n *Node) []metricSample {
+			return aerSamples(n, func(c *pcie.AERCounters) [3]*uint64 {
+				return [3]*uint64{aerTotal(c.Correctable), aerTotal(c.NonFatal), aerTotal(c.Fatal)}
+			})
+		},
+	},
+	{
+		name: "pciex_aer_rootport_errors_total",
+		help: "AER errors reported to the root port by the devices below it since boot.",
+		typ:  "counter",
+		samples: func(n *Node) []metricSample {
+			return aerSamples(n, func(c *pcie.AERCounters) [3]*uint64 {
+				if c.RootPort == nil {
+					return [3]*uint64{}
+				}
+				return [3]*uint64{&c.RootPort.Correctable, &c.RootPort.NonFatal, &c.RootPort.Fatal}
+			})
+		},
+	},
+}
+
+// escapeLabel escapes a label value for the Prometheus text format.
+var escapeLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace
+
+// deviceLabels identify a device in every metric.
+func deviceLabels(n *Node) []metricLabel {
+	return []metricLabel{
+		{"businfo", n.Detail.Businfo},
+		{"vendor", n.Detail.Vendor},
+		{"product", n.Detail.Product},
+		{"class", n.Detail.Class},
+	}
+}
+
+// WriteMetrics writes gauges and counters for every device the filter
+// leaves in the tree, in the Prometheus text exposition format.
+func (m *TreeModel) WriteMetrics(w io.Writer) error {
+	devices := m.Devices()
+	var b strings.Builder
+	for _, family := range metricFamilies {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", family.name, family.help, family.name, family.typ)
+		for _, n := range devices {
+			for _, s := range family.samples(n) {
+				labels := []string{}
+				for _, l := range append(deviceLabels(n), s.labels...) {
+					labels = append(labels, fmt.Sprintf(`%s="%s"`, l.name, escapeLabel(l.value)))
+				}
+				fmt.Fprintf(&b, "%s{%s} %s\n", family.name, strings.Join(labels, ","), strconv.FormatFloat(s.value, 'g', -1, 64))
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
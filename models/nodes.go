@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -18,6 +19,19 @@ type Node struct {
 	Idx      int
 	children Children
 	model    *TreeModel
+	// Changes is set on trees built by `pciex diff` to the ways the node
+	// differs from the other topology.
+	Changes []ChangeKind
+	// flashUntil highlights the node until the given time after it changed
+	// in watch mode.
+	flashUntil time.Time
+	// collapsed hides the node's children.
+	collapsed bool
+	// physFn is set on virtual functions that the tree view shows under
+	// their physical function rather than under their parent.
+	physFn *Node
+	// vfs are the virtual functions the tree view shows under the node.
+	vfs Children
 }
 
 func NewNode(name string, detail pcie.Details, parent *Node, model *TreeModel) *Node {
@@ -38,10 +52,52 @@ func (n *Node) GetDetail() string {
 	return string(out)
 }
 
+// DetailView is what the details pane shows for the node: the analyses
+// that apply to it, followed by GetDetail.
+func (n *Node) DetailView() string {
+	details := n.GetDetail()
+	if o := n.Oversubscription(); o != nil {
+		details = o.String() + "\n\n" + details
+	}
+	if aer := n.Detail.AER; aer != nil {
+		details = aer.String() + "\n" + details
+	}
+	if sriov := n.SRIOVSummary(); sriov != "" {
+		details = sriov + "\n\n" + details
+	}
+	return details
+}
+
+// detailRefreshedMsg carries the result of RefreshDetail back to the
+// RootModel, which applies it. The node is identified by address, since
+// watch mode may have removed it while the refresh ran.
+type detailRefreshedMsg struct {
+	address string
+	detail  pcie.Details
+	err     error
+	at      time.Time
+}
+
+// RefreshDetail re-collects the node's details in the background.
 func (n *Node) RefreshDetail() tea.Cmd {
+	refresh := n.model.Refresher
+	detail := n.Detail
 	return func() tea.Msg {
-		time.Sleep(5 * time.Second)
-		return nil
+		msg := detailRefreshedMsg{address: detail.Address(), at: time.Now()}
+		if refresh == nil {
+			msg.err = errors.New("this topology can't be refreshed")
+			return msg
+		}
+		msg.detail, msg.err = refresh(detail)
+		return msg
+	}
+}
+
+// setDetail replaces the node's details and updates its label to match.
+func (n *Node) setDetail(detail pcie.Details) {
+	n.Detail = detail
+	if n.Parent != nil {
+		n.Name = detail.String()
 	}
 }
 
@@ -57,19 +113,139 @@ func (n *Node) AddChild(name string, detail pcie.Details) *Node {
 	return child
 }
 
+// insertChild makes child the pos'th child of n, or the last if pos is out
+// of range.
+func (n *Node) insertChild(child *Node, pos int) {
+	if pos < 0 || pos > len(n.children) {
+		pos = len(n.children)
+	}
+	n.children = append(n.children, nil)
+	copy(n.children[pos+1:], n.children[pos:])
+	n.children[pos] = child
+	child.Parent = n
+	child.Walk(func(c *Node) bool {
+		c.model = n.model
+		return true
+	})
+	n.reindex()
+}
+
+func (n *Node) removeChild(child *Node) {
+	n.children = append(n.children[:child.Idx], n.children[child.Idx+1:]...)
+	child.Parent = nil
+	n.reindex()
+}
+
+func (n *Node) reindex() {
+	for i, child := range n.children {
+		child.Idx = i
+	}
+}
+
+// IsDescendantOf reports whether n is ancestor itself or is behind it.
+func (n *Node) IsDescendantOf(ancestor *Node) bool {
+	for p := n; p != nil; p = p.Parent {
+		if p == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
 func (n Node) String() string {
 	return n.Name
 }
 
-func (n Node) Value() string {
-	return n.Name
+// Value is the label shown for the node in the tree. Conditions that are
+// otherwise only conveyed by color are appended as badges so they survive
+// rendering without color.
+func (n *Node) Value() string {
+	return n.Name + n.badges(true)
 }
 
-func (n Node) Children() tree.Children {
-	return n.children
+// badges are the badges appended to the node's label. withCollapsed adds
+// the count of children hidden by collapsing the node, which views that
+// draw their own toggle leave out.
+func (n *Node) badges(withCollapsed bool) string {
+	var s string
+	if n.Detail.Link.Downtrained() {
+		s += " [downtrained]"
+	}
+	if aer := n.Detail.AER; aer.HasErrors() {
+		// Root ports can have errors only in what they received from below,
+		// which is broken down in the details.
+		if total := aer.Total(); total > 0 {
+			s += fmt.Sprintf(" [aer %d]", total)
+		} else {
+			s += " [aer]"
+		}
+	}
+	for _, change := range n.Changes {
+		s += " [" + string(change) + "]"
+	}
+	if n.RedirectsP2P() {
+		switch n.Kind() {
+		case KindSwitchDownstream, KindEndpoint:
+			// Root ports redirect too, but requests between root ports go
+			// through the root complex regardless.
+			s += " [acs-redirect]"
+		}
+	}
+	if withCollapsed && n.collapsed {
+		s += fmt.Sprintf(" [+%d]", len(n.viewChildren()))
+	}
+	if n.model != nil && n.model.Marked == n {
+		s += " [marked]"
+	}
+	return s
 }
 
-func (n Node) Hidden() bool {
+// Walk calls fn for n and each of its descendants in depth-first order.
+// Returning false from fn stops the descent into that node's children.
+func (n *Node) Walk(fn func(*Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, child := range n.children {
+		child.Walk(fn)
+	}
+}
+
+// FindByAddress returns the node with the given PCI address, or nil if
+// there isn't one.
+func (n *Node) FindByAddress(address string) *Node {
+	address = pcie.NormalizeAddress(address)
+	var found *Node
+	n.Walk(func(node *Node) bool {
+		if found != nil {
+			return false
+		}
+		if node.Detail.Address() == address {
+			found = node
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// Children returns the children that are displayed, which are none if the
+// node is collapsed.
+func (n *Node) Children() tree.Children {
+	return n.visibleChildren()
+}
+
+// Hidden reports whether the node is behind a collapsed node or pruned by
+// the tree's filter.
+func (n *Node) Hidden() bool {
+	if n.Parent != nil && n.model != nil && n.model.filteredOut(n) {
+		return true
+	}
+	for p := n.viewParent(); p != nil; p = p.viewParent() {
+		if p.collapsed {
+			return true
+		}
+	}
 	return false
 }
 
@@ -0,0 +1,190 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// P2PLink is the kind of path between two devices, named like the legend of
+// `nvidia-smi topo -m`.
+type P2PLink string
+
+const (
+	// P2PSelf is a device's path to itself.
+	P2PSelf P2PLink = "X"
+	// P2PSingleBridge traverses at most a single PCIe bridge or switch.
+	P2PSingleBridge P2PLink = "PIX"
+	// P2PMultipleBridges traverses multiple PCIe bridges or switches, but
+	// not a host bridge.
+	P2PMultipleBridges P2PLink = "PXB"
+	// P2PHostBridge traverses a PCIe host bridge, usually the CPU.
+	P2PHostBridge P2PLink = "PHB"
+	// P2PNode traverses the interconnect between host bridges of the same
+	// NUMA node.
+	P2PNode P2PLink = "NODE"
+	// P2PSystem traverses the interconnect between NUMA nodes.
+	P2PSystem P2PLink = "SYS"
+)
+
+var p2pLegend = []struct {
+	link        P2PLink
+	description string
+}{
+	{P2PSelf, "the device itself"},
+	{P2PSystem, "traverses PCIe as well as the SMP interconnect between NUMA nodes"},
+	{P2PNode, "traverses PCIe as well as the interconnect between PCIe host bridges within a NUMA node"},
+	{P2PHostBridge, "traverses PCIe as well as a PCIe host bridge (typically the CPU)"},
+	{P2PMultipleBridges, "traverses multiple PCIe bridges or switches (without traversing the PCIe host bridge)"},
+	{P2PSingleBridge, "traverses at most a single PCIe bridge or switch"},
+}
+
+// DefaultP2PFilter selects the devices shown in the P2P matrix when no
+// other filter is given. Virtual functions are left out, since their
+// physical function already stands for the device.
+const DefaultP2PFilter = "kind=endpoint && !vf && (class=display || class=network || class=storage)"
+
+// CommonAncestor returns the closest node that both a and b are behind.
+func CommonAncestor(a *Node, b *Node) *Node {
+	for p := a; p != nil; p = p.Parent {
+		if b.IsDescendantOf(p) {
+			return p
+		}
+	}
+	return nil
+}
+
+// switchKey identifies the switch or bridge a node on a path belongs to, so
+// that both ports of a switch count as one hop.
+func switchKey(n *Node) *Node {
+	if n.Kind() == KindSwitchDownstream && n.Parent.Kind() == KindSwitchUpstream {
+		return n.Parent
+	}
+	return n
+}
+
+// P2PPath classifies the path between a and b.
+func P2PPath(a *Node, b *Node) P2PLink {
+	if a == b {
+		return P2PSelf
+	}
+	common := CommonAncestor(a, b)
+	switch {
+	case common == nil || common.Parent == nil:
+		if numaString(a) == numaString(b) {
+			return P2PNode
+		}
+		return P2PSystem
+	case common.Parent.Parent == nil:
+		return P2PHostBridge
+	}
+
+	hops := map[*Node]bool{}
+	for _, n := range []*Node{a, b} {
+		for p := n.Parent; p != common.Parent; p = p.Parent {
+			if p != a && p != b {
+				hops[switchKey(p)] = true
+			}
+		}
+	}
+	if len(hops) <= 1 {
+		return P2PSingleBridge
+	}
+	return P2PMultipleBridges
+}
+
+// P2PMatrix is the path between every pair of a set of devices.
+type P2PMatrix struct {
+	Devices []*Node
+	// Links[i][j] is the path between Devices[i] and Devices[j].
+	Links [][]P2PLink
+}
+
+func NewP2PMatrix(devices []*Node) P2PMatrix {
+	m := P2PMatrix{Devices: devices}
+	for _, a := range devices {
+		row := []P2PLink{}
+		for _, b := range devices {
+			row = append(row, P2PPath(a, b))
+		}
+		m.Links = append(m.Links, row)
+	}
+	return m
+}
+
+// P2PDevices returns the devices under root that match f, or
+// DefaultP2PFilter if f is nil.
+func P2PDevices(root *Node, f *Filter) []*Node {
+	if f == nil {
+		var err error
+		if f, err = ParseFilter(DefaultP2PFilter); err != nil {
+			panic(err)
+		}
+	}
+	devices := []*Node{}
+	root.Walk(func(n *Node) bool {
+		if f.Matches(n) {
+			devices = append(devices, n)
+		}
+		return true
+	})
+	return devices
+}
+
+// shortAddress is the device's address without the PCI domain if it is the
+// default domain.
+func shortAddress(n *Node) string {
+	return strings.TrimPrefix(n.Detail.Address(), "0000:")
+}
+
+// String renders the matrix as a table, followed by the devices and a
+// legend.
+func (m P2PMatrix) String() string {
+	if len(m.Devices) == 0 {
+		return "No devices selected\n"
+	}
+	var b strings.Builder
+	labels := []string{}
+	width := 0
+	for _, n := range m.Devices {
+		label := shortAddress(n)
+		labels = append(labels, label)
+		width = max(width, len(label))
+	}
+	cpus := []string{}
+	cpusWidth := len("CPU Affinity")
+	for _, n := range m.Devices {
+		cpu := "N/A"
+		if n.Detail.LocalCPUList != nil && *n.Detail.LocalCPUList != "" {
+			cpu = *n.Detail.LocalCPUList
+		}
+		cpus = append(cpus, cpu)
+		cpusWidth = max(cpusWidth, len(cpu))
+	}
+
+	fmt.Fprintf(&b, "%-*s", width, "")
+	for _, label := range labels {
+		fmt.Fprintf(&b, "  %-*s", width, label)
+	}
+	fmt.Fprintf(&b, "  %-*s  %s\n", cpusWidth, "CPU Affinity", "NUMA Affinity")
+	for i, row := range m.Links {
+		fmt.Fprintf(&b, "%-*s", width, labels[i])
+		for _, link := range row {
+			fmt.Fprintf(&b, "  %-*s", width, link)
+		}
+		numa := numaString(m.Devices[i])
+		if numa == "none" || numa == "-1" {
+			numa = "N/A"
+		}
+		fmt.Fprintf(&b, "  %-*s  %s\n", cpusWidth, cpus[i], numa)
+	}
+
+	b.WriteString("\nDevices:\n")
+	for i, n := range m.Devices {
+		fmt.Fprintf(&b, "  %-*s  %s\n", width, labels[i], n.Name)
+	}
+	b.WriteString("\nLegend:\n")
+	for _, l := range p2pLegend {
+		fmt.Fprintf(&b, "  %-4s = %s\n", l.link, l.description)
+	}
+	return b.String()
+}
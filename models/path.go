@@ -0,0 +1,103 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Path is the route between two devices through the PCIe hierarchy.
+type Path struct {
+	From *Node
+	To   *Node
+	// Common is the closest node both devices are behind. It is the root
+	// if the devices are behind different root complexes.
+	Common *Node
+	// Nodes is every node on the path in order, starting with From and
+	// ending with To.
+	Nodes []*Node
+	// Bottleneck is the node on the path whose link has the least
+	// bandwidth, or nil if none of the links are known. Ports report the
+	// link below them and other devices the link above them, so every link
+	// reported by a node other than Common is traversed.
+	Bottleneck *Node
+}
+
+func NewPath(from *Node, to *Node) Path {
+	p := Path{From: from, To: to, Common: CommonAncestor(from, to)}
+	for n := from; n != p.Common; n = n.Parent {
+		p.Nodes = append(p.Nodes, n)
+	}
+	p.Nodes = append(p.Nodes, p.Common)
+	down := []*Node{}
+	for n := to; n != p.Common; n = n.Parent {
+		down = append(down, n)
+	}
+	for i := len(down) - 1; i >= 0; i-- {
+		p.Nodes = append(p.Nodes, down[i])
+	}
+
+	for _, n := range p.Nodes {
+		if n == p.Common || !n.Detail.Link.Up() {
+			continue
+		}
+		if p.Bottleneck == nil || n.Detail.Link.Bandwidth() < p.Bottleneck.Detail.Link.Bandwidth() {
+			p.Bottleneck = n
+		}
+	}
+	return p
+}
+
+// Contains reports whether n is on the path.
+func (p Path) Contains(n *Node) bool {
+	for _, node := range p.Nodes {
+		if node == n {
+			return true
+		}
+	}
+	return false
+}
+
+func pathLabel(n *Node) string {
+	if n.Detail.Businfo != "" {
+		return n.Detail.Businfo
+	}
+	if n.Parent == nil {
+		return "system"
+	}
+	return n.Detail.Handle
+}
+
+// String lists every node on the path with its role and link,
+// followed by the slowest link.
+func (p Path) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Path from %s to %s (%s)\n", pathLabel(p.From), pathLabel(p.To), P2PPath(p.From, p.To))
+	labelWidth, kindWidth := 0, 0
+	for _, n := range p.Nodes {
+		labelWidth = max(labelWidth, len(pathLabel(n)))
+		kindWidth = max(kindWidth, len(n.Kind()))
+	}
+	direction := "↑"
+	for _, n := range p.Nodes {
+		if n == p.Common {
+			fmt.Fprintf(&b, "  ● %-*s  %-*s  common ancestor\n", labelWidth, pathLabel(n), kindWidth, n.Kind())
+			direction = "↓"
+			continue
+		}
+		link := "link unknown"
+		switch {
+		case n.Kind() == KindRootComplex:
+			link = ""
+		case n.Detail.Link != nil:
+			link = fmt.Sprintf("%s x%d", n.Detail.Link.CurrentSpeed, n.Detail.Link.CurrentWidth)
+		}
+		fmt.Fprintf(&b, "  %s %-*s  %-*s  %s\n", direction, labelWidth, pathLabel(n), kindWidth, n.Kind(), link)
+	}
+	if p.Bottleneck == nil {
+		b.WriteString("Slowest link: unknown\n")
+	} else {
+		l := p.Bottleneck.Detail.Link
+		fmt.Fprintf(&b, "Slowest link: %s x%d (%.1f GB/s) at %s\n", l.CurrentSpeed, l.CurrentWidth, l.Bandwidth(), pathLabel(p.Bottleneck))
+	}
+	return b.String()
+}
@@ -3,11 +3,13 @@ package models
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -25,6 +27,8 @@ var (
 const (
 	treeView    view = "tree"
 	detailsView      = "details"
+	matrixView       = "p2p matrix"
+	iommuView        = "iommu groups"
 )
 
 type rootKeymap struct {
@@ -60,6 +64,8 @@ type RootModel struct {
 	treeStyle       lipgloss.Style
 	detailsViewport viewport.Model
 	detailsStyle    lipgloss.Style
+	reportViewport  viewport.Model
+	reportStyle     lipgloss.Style
 	view            view
 	height          int
 	width           int
@@ -70,15 +76,24 @@ type RootModel struct {
 	showProgress    bool
 	status          statusbar.Model
 	hostname        string
+	spinner         spinner.Model
+	refreshing      bool
+	lastRefresh     time.Time
+	refreshErr      error
+	// followSelection scrolls the tree to the selected node on the next
+	// render.
+	followSelection bool
 }
 
 func NewRootModel() (*RootModel, error) {
 	details := viewport.New(0, 0)
 	tree := viewport.New(0, 0)
+	report := viewport.New(0, 0)
 
 	viewportKeymap := newViewportKeymaps()
 	viewportKeymap.reassignViewportKeymap(&tree.KeyMap)
 	viewportKeymap.reassignViewportKeymap(&details.KeyMap)
+	viewportKeymap.reassignViewportKeymap(&report.KeyMap)
 
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -89,6 +104,7 @@ func NewRootModel() (*RootModel, error) {
 		Tree:            NewTreeModel(),
 		treeViewport:    tree,
 		detailsViewport: details,
+		reportViewport:  report,
 		view:            treeView,
 		help:            help.New(),
 		keymap: rootKeymap{
@@ -131,6 +147,7 @@ func NewRootModel() (*RootModel, error) {
 			},
 		),
 		hostname: hostname,
+		spinner:  spinner.New(spinner.WithSpinner(spinner.Dot)),
 	}
 	m.status.SetContent("one", "two", "three", "four")
 	return m, nil
@@ -148,8 +165,11 @@ func (m *RootModel) Init() tea.Cmd {
 }
 
 func (m *RootModel) activeViewport() *viewport.Model {
-	if m.view == treeView {
+	switch m.view {
+	case treeView:
 		return &m.treeViewport
+	case matrixView, iommuView:
+		return &m.reportViewport
 	}
 	return &m.detailsViewport
 }
@@ -168,12 +188,20 @@ func (m *RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch {
+		case m.Tree.Editing():
+			// Keys are part of the query until the search or filter is
+			// done.
 		case key.Matches(msg, m.keymap.quit):
 			return m, tea.Quit
 		case key.Matches(msg, m.keymap.tab):
-			if m.view == treeView {
+			switch m.view {
+			case treeView:
 				m.view = detailsView
-			} else {
+			case detailsView:
+				m.view = matrixView
+			case matrixView:
+				m.view = iommuView
+			default:
 				m.view = treeView
 			}
 			m.resizeElements()
@@ -182,7 +210,30 @@ func (m *RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case key.Matches(msg, m.viewportKeymap.HalfPageDown):
 			cmds = append(cmds, m.updateViewports(msg))
 		case key.Matches(msg, m.keymap.refresh):
-			cmds = append(cmds, m.Tree.CurNode.RefreshDetail())
+			if !m.refreshing {
+				m.refreshing = true
+				m.refreshErr = nil
+				cmds = append(cmds, m.Tree.CurNode.RefreshDetail(), m.spinner.Tick)
+			}
+		}
+
+	case detailRefreshedMsg:
+		m.refreshing = false
+		m.refreshErr = msg.err
+		if msg.err != nil || msg.address == "" {
+			break
+		}
+		// The refreshed node is dropped if it was removed in the meantime.
+		if n := m.Tree.Root.FindByAddress(msg.address); n != nil {
+			n.setDetail(msg.detail)
+			m.lastRefresh = msg.at
+		}
+	case spinner.TickMsg:
+		// Let the spinner stop once the refresh is done.
+		if m.refreshing {
+			var cmd tea.Cmd
+			m.spinner, cmd = m.spinner.Update(msg)
+			cmds = append(cmds, cmd)
 		}
 
 	case tea.WindowSizeMsg:
@@ -215,22 +266,85 @@ func (m *RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, tea.Batch(cmds...)
 	}
 
-	if !m.showProgress && m.view == treeView {
+	if _, ok := msg.(watchMsg); ok || (!m.showProgress && m.view == treeView) {
+		selected := m.Tree.CurNode
 		newTree, cmd := m.Tree.Update(msg)
 		m.Tree = newTree.(*TreeModel)
 		cmds = append(cmds, cmd)
+		if m.Tree.CurNode != selected {
+			m.followSelection = true
+		}
 	}
 
 	scrollPercent := m.activeViewport().ScrollPercent()
 	m.status.SetContent(
 		m.Tree.CurNode.Detail.Businfo,
-		m.hostname,
+		m.refreshStatus(),
 		fmt.Sprintf("%d", int(scrollPercent*100))+"%",
 		string(m.view),
 	)
 	return m, tea.Batch(cmds...)
 }
 
+// refreshStatus is the hostname followed by the state of the last refresh.
+func (m *RootModel) refreshStatus() string {
+	s := m.hostname
+	if m.Tree.Hostname != "" {
+		s = m.Tree.Hostname
+	}
+	switch {
+	case m.refreshing:
+		s += " " + m.spinner.View() + " refreshing"
+	case m.refreshErr != nil:
+		s += " | refresh failed: " + m.refreshErr.Error()
+	case !m.lastRefresh.IsZero():
+		s += " | refreshed " + m.lastRefresh.Format("15:04:05")
+	}
+	if m.Tree.WatchErr != nil {
+		s += " | rescan failed: " + m.Tree.WatchErr.Error()
+	} else if m.Tree.Watching() {
+		s += " | watching"
+	}
+	return s
+}
+
+// report is the content of the full-width views, or empty for the tree
+// and details views.
+func (m *RootModel) report() string {
+	switch m.view {
+	case matrixView:
+		return NewP2PMatrix(P2PDevices(m.Tree.Root, m.Tree.Filter())).String()
+	case iommuView:
+		return IOMMUReport(IOMMUGroups(m.Tree.Root))
+	}
+	return ""
+}
+
+// promptsView is the state of the tree's search and filter, which replaces
+// the tree's help while either is used.
+func (m *RootModel) promptsView() string {
+	views := []string{}
+	for _, view := range []string{m.Tree.FilterView(), m.Tree.SearchView()} {
+		if view != "" {
+			views = append(views, view)
+		}
+	}
+	return strings.Join(views, "  ")
+}
+
+// scrollToSelection scrolls the tree viewport as little as possible to make
+// the selected node visible.
+func (m *RootModel) scrollToSelection() {
+	line := m.Tree.Line(m.Tree.CurNode)
+	v := &m.treeViewport
+	switch {
+	case line < v.YOffset:
+		v.SetYOffset(line)
+	case line >= v.YOffset+v.Height:
+		v.SetYOffset(line - v.Height + 1)
+	}
+}
+
 func (m *RootModel) resizeElements() {
 	var (
 		height              int = m.height - 4
@@ -260,6 +374,12 @@ func (m *RootModel) resizeElements() {
 		Width((width - m.treeStyle.GetWidth()))
 	m.detailsViewport.Height = m.detailsStyle.GetHeight()
 	m.detailsViewport.Width = m.detailsStyle.GetWidth()
+
+	m.reportStyle = focusedModelStyle.
+		Height(height - detailsHeightOffset).
+		Width(width)
+	m.reportViewport.Height = m.reportStyle.GetHeight()
+	m.reportViewport.Width = m.reportStyle.GetWidth()
 	m.status.SetSize(m.width)
 }
 
@@ -268,8 +388,16 @@ func (m *RootModel) View() string {
 	if m.showProgress {
 		return m.progress.View()
 	}
-	m.detailsViewport.SetContent(m.Tree.CurNode.GetDetail())
+	details := m.Tree.CurNode.DetailView()
+	if path := m.Tree.Path(); path != nil {
+		details = path.String() + "\n" + details
+	}
+	m.detailsViewport.SetContent(details)
 	m.treeViewport.SetContent(m.Tree.View())
+	if m.followSelection {
+		m.scrollToSelection()
+		m.followSelection = false
+	}
 
 	help := m.help.ShortHelpView([]key.Binding{
 		m.keymap.tab,
@@ -284,11 +412,30 @@ func (m *RootModel) View() string {
 		m.Tree.Keymap.Right,
 		m.Tree.Keymap.Up,
 		m.Tree.Keymap.Down,
+		m.Tree.Keymap.Search,
+		m.Tree.Keymap.NextMatch,
+		m.Tree.Keymap.Toggle,
+		m.Tree.Keymap.ExpandToDepth,
+		m.Tree.Keymap.Filter,
+		m.Tree.Keymap.Mark,
 	})
+	if prompts := m.promptsView(); prompts != "" {
+		treeHelp = prompts
+	}
 	detailsHelp := m.help.ShortHelpView([]key.Binding{
 		m.detailsViewport.KeyMap.HalfPageUp,
 		m.detailsViewport.KeyMap.HalfPageDown,
 	})
+	if report := m.report(); report != "" {
+		m.reportViewport.SetContent(report)
+		reportViewport := lipgloss.JoinVertical(lipgloss.Top, m.reportViewport.View(), detailsHelp)
+		return lipgloss.JoinVertical(
+			lipgloss.Top,
+			m.reportStyle.Render(reportViewport),
+			help,
+			m.status.View(),
+		)
+	}
 	treeViewport := lipgloss.JoinVertical(lipgloss.Top, m.treeViewport.View(), treeHelp)
 	detailsViewport := lipgloss.JoinVertical(lipgloss.Top, m.detailsViewport.View(), detailsHelp)
 	s += lipgloss.JoinHorizontal(
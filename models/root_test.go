@@ -0,0 +1,45 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LandonTClipp/pciex/pcie"
+)
+
+func TestDetailRefreshedAfterRemoval(t *testing.T) {
+	devices := []watchDevice{
+		{"0000:01:00.0", "0000:00:01.0", 0},
+		{"0000:01:00.1", "0000:00:01.0", 0},
+	}
+	m, err := NewRootModel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Tree = newWatchTree(devices...)
+	m.Tree.CurNode = m.Tree.Root.FindByAddress("0000:01:00.1")
+	refreshed := func(address string) detailRefreshedMsg {
+		numa := 1
+		detail := pcie.Details{Businfo: "pci@" + address, Class: "display"}
+		detail.NumaNode = &numa
+		return detailRefreshedMsg{address: address, detail: detail, at: time.Now()}
+	}
+
+	// The device is removed by watch mode while it is being refreshed.
+	m.Tree.Sync(newWatchTree(devices[0]).Root)
+	m.Update(refreshed("0000:01:00.1"))
+	if !m.lastRefresh.IsZero() {
+		t.Error("the refresh of a removed device was applied")
+	}
+	if m.Tree.Root.FindByAddress("0000:01:00.1") != nil {
+		t.Error("the refresh of a removed device brought it back")
+	}
+
+	m.Update(refreshed("0000:01:00.0"))
+	if n := m.Tree.Root.FindByAddress("0000:01:00.0"); *n.Detail.NumaNode != 1 {
+		t.Errorf("numa_node after the refresh = %d, want 1", *n.Detail.NumaNode)
+	}
+	if m.lastRefresh.IsZero() {
+		t.Error("the refresh time wasn't recorded")
+	}
+}
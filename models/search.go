@@ -0,0 +1,241 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// search is the state of the tree's `/` search.
+type search struct {
+	input textinput.Model
+	// editing is true while the query is being typed.
+	editing bool
+	// origin is the node that was selected when the search started. It is
+	// restored if the search is cancelled, unless it was removed since.
+	origin  *Node
+	matches []*Node
+	// isMatch indexes matches for styling.
+	isMatch map[*Node]bool
+	cur     int
+}
+
+func newSearch() search {
+	input := textinput.New()
+	input.Prompt = "/"
+	return search{input: input}
+}
+
+// MatchesQuery reports whether the node's bus address, vendor, product,
+// class or driver contains query, ignoring case.
+func (n *Node) MatchesQuery(query string) bool {
+	if query == "" {
+		return false
+	}
+	query = strings.ToLower(query)
+	for _, field := range []string{
+		n.Detail.Businfo,
+		n.Detail.Vendor,
+		n.Detail.Product,
+		n.Detail.Class,
+		n.Detail.Driver(),
+	} {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// Searching reports whether the search prompt has focus.
+func (m *TreeModel) Searching() bool {
+	return m.search.editing
+}
+
+// Editing reports whether the search or filter prompt has focus, in which
+// case all keys belong to the tree.
+func (m *TreeModel) Editing() bool {
+	return m.search.editing || m.filterBar.editing
+}
+
+// IsMatch reports whether n matches the current search.
+func (m *TreeModel) IsMatch(n *Node) bool {
+	return m.search.isMatch[n]
+}
+
+// Search selects the first node at or after the current selection that
+// matches query. All matches are highlighted until the next search.
+func (m *TreeModel) Search(query string) {
+	s := &m.search
+	s.matches = nil
+	s.isMatch = nil
+	s.cur = 0
+	if query == "" {
+		return
+	}
+	s.isMatch = map[*Node]bool{}
+	for _, child := range m.Root.viewChildren() {
+		child.walkView(func(n *Node) bool {
+			if m.filteredOut(n) {
+				return false
+			}
+			if n.MatchesQuery(query) {
+				s.matches = append(s.matches, n)
+				s.isMatch[n] = true
+			}
+			return true
+		})
+	}
+	if len(s.matches) == 0 {
+		if s.origin != nil {
+			m.CurNode = s.origin
+		}
+		return
+	}
+
+	// Start from the node the search began on so that typing more of the
+	// query doesn't skip past earlier matches.
+	from := m.CurNode
+	if s.origin != nil {
+		from = s.origin
+	}
+	order := m.order()
+	for i, match := range s.matches {
+		if order[match] >= order[from] {
+			s.cur = i
+			break
+		}
+	}
+	m.selectMatch()
+}
+
+// selectMatch selects the current match, expanding its ancestors if it is
+// hidden.
+func (m *TreeModel) selectMatch() {
+	m.CurNode = m.search.matches[m.search.cur]
+	m.ExpandPath(m.CurNode)
+}
+
+// NextMatch selects the next match, wrapping around at the end. A negative
+// step selects previous matches.
+func (m *TreeModel) NextMatch(step int) {
+	s := &m.search
+	if len(s.matches) == 0 {
+		return
+	}
+	s.cur = (s.cur + step + len(s.matches)) % len(s.matches)
+	m.selectMatch()
+}
+
+// prune forgets matches that are no longer in the tree or that the filter
+// hides.
+func (m *TreeModel) pruneSearch() {
+	s := &m.search
+	keep := func(n *Node) bool {
+		return n.IsDescendantOf(m.Root) && !m.filteredOut(n)
+	}
+	if s.origin != nil && !keep(s.origin) {
+		s.origin = nil
+	}
+	if s.isMatch == nil {
+		return
+	}
+	matches := []*Node{}
+	for _, n := range s.matches {
+		if keep(n) {
+			matches = append(matches, n)
+		} else {
+			delete(s.isMatch, n)
+		}
+	}
+	s.matches = matches
+	if s.cur >= len(matches) {
+		s.cur = 0
+	}
+}
+
+// order numbers every node, including hidden ones, in the order they are
+// displayed.
+func (m *TreeModel) order() map[*Node]int {
+	order := map[*Node]int{}
+	m.Root.walkView(func(n *Node) bool {
+		order[n] = len(order)
+		return true
+	})
+	return order
+}
+
+// Line returns the line n is displayed on in View.
+func (m *TreeModel) Line(n *Node) int {
+	line, found := 0, false
+	m.Root.walkView(func(node *Node) bool {
+		if found || node.Hidden() {
+			return false
+		}
+		if node == n {
+			found = true
+			return false
+		}
+		line++
+		return true
+	})
+	return line
+}
+
+func (m *TreeModel) updateSearch(msg tea.KeyMsg) tea.Cmd {
+	s := &m.search
+	switch msg.String() {
+	case "enter":
+		s.editing = false
+		s.origin = nil
+		s.input.Blur()
+		return nil
+	case "esc", "ctrl+c":
+		s.editing = false
+		s.input.Blur()
+		s.input.Reset()
+		s.matches = nil
+		s.isMatch = nil
+		// The origin is forgotten if it was removed while searching, in
+		// which case the selection stays where it is.
+		if s.origin != nil {
+			m.CurNode = s.origin
+		}
+		s.origin = nil
+		return nil
+	}
+	var cmd tea.Cmd
+	s.input, cmd = s.input.Update(msg)
+	m.Search(s.input.Value())
+	return cmd
+}
+
+func (m *TreeModel) startSearch() tea.Cmd {
+	s := &m.search
+	s.editing = true
+	s.origin = m.CurNode
+	s.input.Reset()
+	return s.input.Focus()
+}
+
+// SearchView is the search prompt while a query is typed, followed by the
+// position of the selection among the matches.
+func (m *TreeModel) SearchView() string {
+	s := m.search
+	if !s.editing && s.isMatch == nil {
+		return ""
+	}
+	view := s.input.View()
+	if !s.editing {
+		view = "/" + s.input.Value()
+	}
+	if s.isMatch == nil {
+		return view
+	}
+	if len(s.matches) == 0 {
+		return view + "  no matches"
+	}
+	return view + fmt.Sprintf("  %d/%d", s.cur+1, len(s.matches))
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func typeQuery(m *TreeModel, query string) {
+	for _, r := range query {
+		m.updateSearch(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+}
+
+func TestCancelSearch(t *testing.T) {
+	devices := []watchDevice{
+		{"0000:01:00.0", "0000:00:01.0", 0},
+		{"0000:01:00.1", "0000:00:01.0", 0},
+		{"0000:02:00.0", "0000:00:02.0", 0},
+	}
+	for _, tt := range []struct {
+		name string
+		// after is the topology synced while searching, if any.
+		after []watchDevice
+		want  string
+	}{
+		{
+			name: "origin restored",
+			want: "0000:01:00.1",
+		},
+		{
+			name:  "origin removed",
+			after: []watchDevice{devices[0], devices[2]},
+			want:  "0000:02:00.0",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newWatchTree(devices...)
+			m.CurNode = m.Root.FindByAddress("0000:01:00.1")
+			m.startSearch()
+			typeQuery(m, "02:00")
+			if got := m.CurNode.Detail.Address(); got != "0000:02:00.0" {
+				t.Fatalf("search selected %s, want 0000:02:00.0", got)
+			}
+			if tt.after != nil {
+				m.Sync(newWatchTree(tt.after...).Root)
+			}
+			m.updateSearch(tea.KeyMsg{Type: tea.KeyEsc})
+			if m.CurNode == nil {
+				t.Fatal("cancelling the search cleared the selection")
+			}
+			if got := m.CurNode.Detail.Address(); got != tt.want {
+				t.Errorf("selected %s after cancelling, want %s", got, tt.want)
+			}
+		})
+	}
+}
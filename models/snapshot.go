@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"github.com/LandonTClipp/pciex/pcie"
+)
+
+// SnapshotSchemaVersion is incremented whenever a field of Snapshot or
+// SnapshotDevice is removed or changes meaning. Adding fields does not
+// change the version.
+const SnapshotSchemaVersion = 1
+
+// Snapshot is the document written by `pciex export`. It captures the whole
+// enriched topology of a machine so it can be ingested elsewhere or loaded
+// back into pciex.
+type Snapshot struct {
+	SchemaVersion int              `json:"schema_version" yaml:"schema_version"`
+	Hostname      string           `json:"hostname" yaml:"hostname"`
+	CollectedAt   time.Time        `json:"collected_at" yaml:"collected_at"`
+	Collector     string           `json:"collector" yaml:"collector"`
+	Devices       []SnapshotDevice `json:"devices" yaml:"devices"`
+}
+
+// SnapshotDevice is a device and everything behind it. The device's fields
+// are inlined alongside children.
+type SnapshotDevice struct {
+	pcie.Details `yaml:",inline"`
+	Children     []SnapshotDevice `json:"children,omitempty" yaml:"children,omitempty"`
+}
+
+func newSnapshotDevices(nodes Children) []SnapshotDevice {
+	devices := []SnapshotDevice{}
+	for _, node := range nodes {
+		if node.model != nil && node.model.filteredOut(node) {
+			continue
+		}
+		devices = append(devices, SnapshotDevice{
+			Details:  node.Detail,
+			Children: newSnapshotDevices(node.children),
+		})
+	}
+	return devices
+}
+
+// NewSnapshot captures the tree under root. The root node itself is not
+// included, only its children. Nodes hidden by the tree's filter are left
+// out.
+func NewSnapshot(root *Node, hostname string, collector string) Snapshot {
+	return Snapshot{
+		SchemaVersion: SnapshotSchemaVersion,
+		Hostname:      hostname,
+		CollectedAt:   time.Now().UTC(),
+		Collector:     collector,
+		Devices:       newSnapshotDevices(root.children),
+	}
+}
+
+func addSnapshotDevices(parent *Node, devices []SnapshotDevice) {
+	for _, device := range devices {
+		child := parent.AddChild(device.Details.String(), device.Details)
+		addSnapshotDevices(child, device.Children)
+	}
+}
+
+// Build replaces the contents of tree with the topology in the snapshot.
+func (s Snapshot) Build(tree *TreeModel) {
+	tree.Root = NewNode("root", pcie.Details{}, nil, tree)
+	tree.Hostname = s.Hostname
+	addSnapshotDevices(tree.Root, s.Devices)
+	GroupVirtualFunctions(tree.Root)
+}
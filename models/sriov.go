@@ -0,0 +1,76 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IsVirtualFunction reports whether the node is an SR-IOV virtual function.
+func (n *Node) IsVirtualFunction() bool {
+	return n.Detail.PhysFn != nil
+}
+
+// VirtualFunctions returns the virtual functions the tree view shows under
+// the node.
+func (n *Node) VirtualFunctions() []*Node {
+	return append([]*Node{}, n.vfs...)
+}
+
+// GroupVirtualFunctions makes the tree view show every virtual function
+// under root under its physical function instead of beside it. Physical
+// functions that weren't grouping VFs yet are collapsed, so that their VFs
+// are hidden until expanded. VFs whose physical function isn't in the tree
+// are left where they are. The bus hierarchy in Parent and the children
+// that analyses and exports walk is not changed, so this can be called
+// again after the tree changes.
+func GroupVirtualFunctions(root *Node) {
+	byAddress := map[string]*Node{}
+	vfs := []*Node{}
+	grouping := map[*Node]bool{}
+	root.Walk(func(n *Node) bool {
+		if address := n.Detail.Address(); address != "" {
+			byAddress[address] = n
+		}
+		if n.IsVirtualFunction() {
+			vfs = append(vfs, n)
+		}
+		grouping[n] = len(n.vfs) > 0
+		n.physFn = nil
+		n.vfs = nil
+		return true
+	})
+	for _, vf := range vfs {
+		pf := byAddress[*vf.Detail.PhysFn]
+		if pf == nil || pf == vf {
+			continue
+		}
+		vf.physFn = pf
+		pf.vfs = append(pf.vfs, vf)
+	}
+	for pf := range grouping {
+		if len(pf.vfs) > 0 && !grouping[pf] {
+			pf.SetCollapsed(true)
+		}
+	}
+}
+
+// SRIOVSummary describes the virtual functions of a physical function, or
+// the physical function of a virtual function. It is empty for other
+// devices.
+func (n *Node) SRIOVSummary() string {
+	if n.IsVirtualFunction() {
+		return fmt.Sprintf("SR-IOV: virtual function of pci@%s", *n.Detail.PhysFn)
+	}
+	s := n.Detail.SRIOV
+	if s == nil {
+		return ""
+	}
+	parts := []string{fmt.Sprintf("%d of %d VFs enabled", s.NumVFs, s.TotalVFs)}
+	if s.Offset != nil && s.Stride != nil {
+		parts = append(parts, fmt.Sprintf("offset %d, stride %d", *s.Offset, *s.Stride))
+	}
+	if s.VFDeviceID != nil {
+		parts = append(parts, "VF device ID "+s.VFDeviceID.String())
+	}
+	return "SR-IOV: " + strings.Join(parts, ", ")
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/LandonTClipp/pciex/pcie"
+)
+
+func newSRIOVTree() (tree *TreeModel, rp *Node, pf *Node, vfs []*Node) {
+	tree = NewTreeModel()
+	tree.Root = NewNode("root", pcie.Details{}, nil, tree)
+	rc := tree.Root.AddChild("rc", pcie.Details{Class: "bridge", Handle: "PCIBUS:0000:00"})
+	rp = addDevice(rc, "0000:00:01.0", "bridge")
+	pf = addDevice(rp, "0000:01:00.0", "network")
+	for _, address := range []string{"0000:01:00.1", "0000:01:00.2"} {
+		vf := addDevice(rp, address, "network")
+		physFn := "0000:01:00.0"
+		vf.Detail.PhysFn = &physFn
+		vfs = append(vfs, vf)
+	}
+	GroupVirtualFunctions(tree.Root)
+	return tree, rp, pf, vfs
+}
+
+func TestGroupVirtualFunctions(t *testing.T) {
+	tree, rp, pf, vfs := newSRIOVTree()
+
+	// The bus hierarchy is unchanged.
+	if len(rp.children) != 3 || len(pf.children) != 0 {
+		t.Fatalf("root port has %d children and PF has %d, want 3 and 0", len(rp.children), len(pf.children))
+	}
+	for _, vf := range vfs {
+		if vf.Parent != rp {
+			t.Errorf("%s: Parent = %s, want the root port", vf.Detail.Businfo, vf.Parent)
+		}
+	}
+	snapshot := NewSnapshot(tree.Root, "", "")
+	if got := len(snapshot.Devices[0].Children[0].Children); got != 3 {
+		t.Errorf("snapshot has %d devices behind the root port, want 3", got)
+	}
+	if got := P2PPath(pf, vfs[0]); got != P2PSingleBridge {
+		t.Errorf("P2PPath(PF, VF) = %s, want %s", got, P2PSingleBridge)
+	}
+
+	// The view shows the VFs under the collapsed PF.
+	if got := rp.viewChildren(); len(got) != 1 || got[0] != pf {
+		t.Errorf("root port shows %v, want only the PF", got)
+	}
+	if got := pf.viewChildren(); len(got) != 2 || got[0] != vfs[0] || got[1] != vfs[1] {
+		t.Errorf("PF shows %v, want its VFs", got)
+	}
+	if !pf.Collapsed() || !vfs[0].Hidden() {
+		t.Error("PF should start out collapsed with its VFs hidden")
+	}
+	if got := pf.VirtualFunctions(); len(got) != 2 {
+		t.Errorf("VirtualFunctions() returned %d nodes, want 2", len(got))
+	}
+
+	// Regrouping keeps the collapse state the user chose.
+	pf.SetCollapsed(false)
+	GroupVirtualFunctions(tree.Root)
+	if pf.Collapsed() {
+		t.Error("regrouping collapsed an expanded PF")
+	}
+
+	// Right from the PF goes to its first VF, and down from there to the
+	// next one rather than to the VFs' parent in the bus hierarchy.
+	if got := pf.visibleChildren(); len(got) != 2 || got[0] != vfs[0] {
+		t.Fatalf("PF shows %v, want its VFs", got)
+	}
+	if next := findClosestRelative(vfs[0]); next != vfs[1] {
+		t.Errorf("down from the first VF selected %v, want the second", next)
+	}
+	if prev := sibling(vfs[0], -1); prev != nil {
+		t.Errorf("up from the first VF selected %v, want its PF", prev)
+	}
+	if parent := vfs[0].viewParent(); parent != pf {
+		t.Errorf("left from a VF goes to %v, want the PF", parent)
+	}
+}
+
+func TestFilterShowsPhysicalFunctionOfMatchingVF(t *testing.T) {
+	tree, rp, pf, vfs := newSRIOVTree()
+	filter, err := ParseFilter("vf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.SetFilter(filter)
+	for _, n := range []*Node{rp, pf, vfs[0], vfs[1]} {
+		if tree.filteredOut(n) {
+			t.Errorf("%s is filtered out", n.Detail.Businfo)
+		}
+	}
+}
+
+func TestP2PDevicesLeaveOutVirtualFunctions(t *testing.T) {
+	tree, rp, pf, vfs := newSRIOVTree()
+	gpu := addDevice(rp, "0000:01:01.0", "display")
+
+	got := P2PDevices(tree.Root, nil)
+	if len(got) != 2 || got[0] != pf || got[1] != gpu {
+		t.Errorf("P2PDevices = %v, want the PF and the GPU", got)
+	}
+	if got := NewP2PMatrix(got); len(got.Devices) != 2 {
+		t.Errorf("matrix has %d devices, want 2", len(got.Devices))
+	}
+
+	// VFs are still matched when asked for.
+	f, err := ParseFilter("vf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := P2PDevices(tree.Root, f); len(got) != len(vfs) {
+		t.Errorf("P2PDevices(vf) = %v, want the %d VFs", got, len(vfs))
+	}
+}
+
+func TestExpandToDepthVirtualFunctions(t *testing.T) {
+	tree, _, pf, vfs := newSRIOVTree()
+	if got := vfs[0].Depth(); got != 4 {
+		t.Errorf("VF depth = %d, want 4, one below its PF", got)
+	}
+	tree.ExpandToDepth(3)
+	if !pf.Collapsed() || !vfs[0].Hidden() {
+		t.Error("expanding to depth 3 showed the VFs")
+	}
+	tree.ExpandToDepth(4)
+	if pf.Collapsed() || vfs[0].Hidden() {
+		t.Error("expanding to depth 4 didn't show the VFs")
+	}
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/lipgloss/tree"
@@ -15,6 +16,12 @@ var (
 	backgroundColorSelected = lipgloss.Color("57")
 	borderColor             = lipgloss.Color("69")
 	treeColor               = lipgloss.Color("63")
+	downtrainedColor        = lipgloss.Color("208")
+	aerColor                = lipgloss.Color("196")
+	addedColor              = lipgloss.Color("42")
+	removedColor            = lipgloss.Color("196")
+	movedColor              = lipgloss.Color("39")
+	modifiedColor           = lipgloss.Color("220")
 	lambdaPurple            = lipgloss.Color("#6124DF")
 )
 
@@ -23,8 +30,31 @@ var (
 	itemStyleSelected = lipgloss.NewStyle().Foreground(foregroundColorSelected).
 				Background(backgroundColorSelected).
 				Bold(true)
-	viewportStyle = lipgloss.NewStyle().Foreground(foregroundColor).
-			Border(lipgloss.NormalBorder())
+	// itemStyleDowntrained marks nodes whose link trained below its
+	// maximum speed or width.
+	itemStyleDowntrained = lipgloss.NewStyle().Foreground(downtrainedColor).
+				Underline(true)
+	// itemStyleAER marks nodes that reported AER errors.
+	itemStyleAER = lipgloss.NewStyle().Foreground(aerColor).Bold(true)
+	// itemStyleFlash briefly highlights nodes that changed in watch mode.
+	itemStyleFlash = lipgloss.NewStyle().Foreground(foregroundColorSelected).
+			Background(modifiedColor).
+			Bold(true)
+	// itemStyleMarked and itemStylePath highlight the marked node and the
+	// nodes between it and the selection.
+	itemStyleMarked = lipgloss.NewStyle().Foreground(foregroundColorSelected).
+			Background(movedColor).
+			Bold(true)
+	itemStylePath = lipgloss.NewStyle().Foreground(movedColor).Bold(true)
+	// itemStyleMatch highlights the nodes that match the current search.
+	itemStyleMatch = lipgloss.NewStyle().Foreground(foregroundColorSelected).
+			Background(treeColor)
+	itemStyleAdded    = lipgloss.NewStyle().Foreground(addedColor)
+	itemStyleRemoved  = lipgloss.NewStyle().Foreground(removedColor).Strikethrough(true)
+	itemStyleMoved    = lipgloss.NewStyle().Foreground(movedColor)
+	itemStyleModified = lipgloss.NewStyle().Foreground(modifiedColor)
+	viewportStyle     = lipgloss.NewStyle().Foreground(foregroundColor).
+				Border(lipgloss.NormalBorder())
 	enumeratorStyle   = lipgloss.NewStyle().Foreground(treeColor).MarginRight(1)
 	rootStyle         = itemStyle
 	focusedModelStyle = lipgloss.NewStyle().
@@ -63,6 +93,27 @@ func itemStyleFunc(children tree.Children, i int) lipgloss.Style {
 		if n.model.CurNode == n {
 			return itemStyleSelected
 		}
+		if n.model.Marked == n {
+			return itemStyleMarked
+		}
+		if n.model.path != nil && n.model.path.Contains(n) {
+			return itemStylePath
+		}
+		if n.model.IsMatch(n) {
+			return itemStyleMatch
+		}
+		if time.Now().Before(n.flashUntil) {
+			return itemStyleFlash
+		}
+		if len(n.Changes) > 0 {
+			return changeStyle(n.Changes)
+		}
+		if n.Detail.AER.HasErrors() {
+			return itemStyleAER
+		}
+		if n.Detail.Link.Downtrained() {
+			return itemStyleDowntrained
+		}
 	} else {
 		debug(fmt.Sprintf("Is not *Node. Is: %T\n", child))
 	}
@@ -70,8 +121,29 @@ func itemStyleFunc(children tree.Children, i int) lipgloss.Style {
 	return itemStyle
 }
 
+// changeStyle picks the style of the most significant kind of change.
+func changeStyle(kinds []ChangeKind) lipgloss.Style {
+	style := itemStyleModified
+	for _, kind := range kinds {
+		switch kind {
+		case ChangeAdded:
+			return itemStyleAdded
+		case ChangeRemoved:
+			return itemStyleRemoved
+		case ChangeMoved:
+			style = itemStyleMoved
+		}
+	}
+	return style
+}
+
+// debugEnabled turns on logging of tree navigation to out.txt.
+const debugEnabled = false
+
 func debug(s string) {
-	return
+	if !debugEnabled {
+		return
+	}
 
 	out := pathlib.NewPath("out.txt")
 	file, err := out.OpenFile(os.O_APPEND | os.O_WRONLY | os.O_CREATE)
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/LandonTClipp/pciex/pcie"
+)
+
+// NodeKind is the role of a node in the PCIe hierarchy.
+type NodeKind string
+
+const (
+	KindRoot             NodeKind = "root"
+	KindRootComplex      NodeKind = "root complex"
+	KindRootPort         NodeKind = "root port"
+	KindSwitchUpstream   NodeKind = "switch upstream port"
+	KindSwitchDownstream NodeKind = "switch downstream port"
+	KindBridge           NodeKind = "bridge"
+	KindEndpoint         NodeKind = "endpoint"
+)
+
+// IsPCIBridge reports whether the node forwards to a secondary bus.
+func (n *Node) IsPCIBridge() bool {
+	if config := n.Detail.Config; config != nil {
+		return config.Header.HeaderType == pcie.HeaderTypeBridge
+	}
+	return strings.HasPrefix(n.Detail.Handle, "PCIBUS:")
+}
+
+// Kind classifies the node. The port type from the PCI Express capability is
+// used when it could be read; otherwise the kind is inferred from the node's
+// position in the tree.
+func (n *Node) Kind() NodeKind {
+	if n.Parent == nil {
+		return KindRoot
+	}
+	if n.Parent.Parent == nil {
+		return KindRootComplex
+	}
+	if n.Detail.Config != nil {
+		if express := n.Detail.Config.Express(); express != nil {
+			switch express.PortType {
+			case pcie.PortTypeRootPort:
+				return KindRootPort
+			case pcie.PortTypeUpstream:
+				return KindSwitchUpstream
+			case pcie.PortTypeDownstream:
+				return KindSwitchDownstream
+			case pcie.PortTypePCIEToPCIBridge, pcie.PortTypePCIToPCIEBridge:
+				return KindBridge
+			default:
+				return KindEndpoint
+			}
+		}
+	}
+	if !n.IsPCIBridge() {
+		return KindEndpoint
+	}
+	switch n.Parent.Kind() {
+	case KindRootComplex:
+		return KindRootPort
+	case KindRootPort, KindSwitchDownstream:
+		return KindSwitchUpstream
+	case KindSwitchUpstream:
+		return KindSwitchDownstream
+	}
+	return KindBridge
+}
+
+// Switch returns the upstream port of the switch the node is directly
+// behind, or nil if it isn't behind a switch.
+func (n *Node) Switch() *Node {
+	for p := n.Parent; p != nil; p = p.Parent {
+		switch p.Kind() {
+		case KindSwitchUpstream:
+			return p
+		case KindRootPort, KindRootComplex:
+			return nil
+		}
+	}
+	return nil
+}
+
+// RootComplex returns the root complex the node is behind.
+func (n *Node) RootComplex() *Node {
+	for p := n; p != nil && p.Parent != nil; p = p.Parent {
+		if p.Parent.Parent == nil {
+			return p
+		}
+	}
+	return nil
+}
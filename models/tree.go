@@ -2,23 +2,59 @@ package models
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/LandonTClipp/pciex/pcie"
 	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss/tree"
 )
 
 type TreeKeymap struct {
-	Left  key.Binding
-	Right key.Binding
-	Up    key.Binding
-	Down  key.Binding
+	Left      key.Binding
+	Right     key.Binding
+	Up        key.Binding
+	Down      key.Binding
+	Search    key.Binding
+	NextMatch key.Binding
+	PrevMatch key.Binding
+	// Toggle collapses or expands the selected node.
+	Toggle         key.Binding
+	CollapseAll    key.Binding
+	ExpandAll      key.Binding
+	ExpandToDepth  key.Binding
+	FocusSelection key.Binding
+	Filter         key.Binding
+	// Mark marks the selected node as one end of a path.
+	Mark key.Binding
 }
 
+// Refresher re-collects the details of a single device.
+type Refresher func(pcie.Details) (pcie.Details, error)
+
 type TreeModel struct {
 	Root    *Node
 	CurNode *Node
 	Keymap  TreeKeymap
+	// Hostname is the machine the topology was collected on.
+	Hostname string
+	// Refresher is used to refresh the selected node. It is nil if the
+	// topology can't be refreshed, such as when it was loaded from a file.
+	Refresher Refresher
+	// WatchErr is the error of the last rescan in watch mode.
+	WatchErr      error
+	scanner       Scanner
+	watchInterval time.Duration
+	search        search
+	filter        *Filter
+	// shown is the set of nodes the filter leaves visible.
+	shown     map[*Node]bool
+	filterBar filterBar
+	// Marked is the node marked as the start of a path to the selection, or
+	// nil if none is.
+	Marked *Node
+	// path is the path between Marked and CurNode as of the last render.
+	path *Path
 }
 
 func NewTreeModel() *TreeModel {
@@ -40,24 +76,100 @@ func NewTreeModel() *TreeModel {
 				key.WithKeys("down"),
 				key.WithHelp("↓", "down"),
 			),
+			Search: key.NewBinding(
+				key.WithKeys("/"),
+				key.WithHelp("/", "search"),
+			),
+			NextMatch: key.NewBinding(
+				key.WithKeys("n"),
+				key.WithHelp("n/N", "next/prev match"),
+			),
+			PrevMatch: key.NewBinding(
+				key.WithKeys("N"),
+				key.WithHelp("N", "prev match"),
+			),
+			Toggle: key.NewBinding(
+				key.WithKeys(" "),
+				key.WithHelp("space", "collapse/expand"),
+			),
+			CollapseAll: key.NewBinding(
+				key.WithKeys("c"),
+				key.WithHelp("c", "collapse all"),
+			),
+			ExpandAll: key.NewBinding(
+				key.WithKeys("e"),
+				key.WithHelp("e", "expand all"),
+			),
+			ExpandToDepth: key.NewBinding(
+				key.WithKeys("1", "2", "3", "4", "5", "6", "7", "8", "9"),
+				key.WithHelp("1-9", "expand to depth"),
+			),
+			FocusSelection: key.NewBinding(
+				key.WithKeys("f"),
+				key.WithHelp("f", "expand only selection"),
+			),
+			Filter: key.NewBinding(
+				key.WithKeys("F"),
+				key.WithHelp("F", "filter"),
+			),
+			Mark: key.NewBinding(
+				key.WithKeys("m"),
+				key.WithHelp("m", "mark path"),
+			),
 		},
+		search:    newSearch(),
+		filterBar: newFilterBar(),
 	}
 	return m
 }
 
+// firstVisible returns the first node shown in the tree. If the tree is
+// empty or the filter hides every device, it is the root, which isn't shown.
+func (m *TreeModel) firstVisible() *Node {
+	if visible := m.Root.visibleChildren(); len(visible) > 0 {
+		return visible[0]
+	}
+	return m.Root
+}
+
 func (m *TreeModel) Init() tea.Cmd {
-	m.CurNode = m.Root.children[0]
+	m.CurNode = m.firstVisible()
+	if m.Watching() {
+		return m.scheduleRescan()
+	}
+	return nil
+}
+
+// sibling returns the closest visible sibling of curNode in the direction
+// of step, or nil if there isn't one.
+func sibling(curNode *Node, step int) *Node {
+	parent := curNode.viewParent()
+	if parent == nil {
+		return nil
+	}
+	siblings := parent.viewChildren()
+	idx := 0
+	for i, s := range siblings {
+		if s == curNode {
+			idx = i
+		}
+	}
+	for i := idx + step; i >= 0 && i < len(siblings); i += step {
+		if !siblings[i].Hidden() {
+			return siblings[i]
+		}
+	}
 	return nil
 }
 
 func findClosestRelative(curNode *Node) *Node {
-	if curNode.Parent == nil {
+	if curNode.viewParent() == nil {
 		return nil
 	}
-	if curNode.Idx < len(curNode.Parent.children)-1 {
-		return curNode.Parent.children[curNode.Idx+1]
+	if next := sibling(curNode, 1); next != nil {
+		return next
 	}
-	return findClosestRelative(curNode.Parent)
+	return findClosestRelative(curNode.viewParent())
 }
 
 func (m *TreeModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -66,8 +178,44 @@ func (m *TreeModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	)
 	debug(fmt.Sprintf("CurNode: %s \tCurNodeIdx: %d \tlen(Children): %d \n", m.CurNode.Name, m.CurNode.Idx, len(m.CurNode.children)))
 	switch msg := msg.(type) {
-	// Is it a key press?
+	case watchMsg:
+		cmds = append(cmds, m.updateWatch(msg))
 	case tea.KeyMsg:
+		if m.Searching() {
+			cmds = append(cmds, m.updateSearch(msg))
+			break
+		}
+		if m.filterBar.editing {
+			cmds = append(cmds, m.updateFilter(msg))
+			break
+		}
+		switch {
+		case key.Matches(msg, m.Keymap.Search):
+			cmds = append(cmds, m.startSearch())
+		case key.Matches(msg, m.Keymap.NextMatch):
+			m.NextMatch(1)
+		case key.Matches(msg, m.Keymap.PrevMatch):
+			m.NextMatch(-1)
+		case key.Matches(msg, m.Keymap.Toggle):
+			m.ToggleCollapsed()
+		case key.Matches(msg, m.Keymap.CollapseAll):
+			m.CollapseAll()
+		case key.Matches(msg, m.Keymap.ExpandAll):
+			m.ExpandAll()
+		case key.Matches(msg, m.Keymap.ExpandToDepth):
+			m.ExpandToDepth(int(msg.Runes[0] - '0'))
+		case key.Matches(msg, m.Keymap.FocusSelection):
+			m.FocusSelection()
+		case key.Matches(msg, m.Keymap.Filter):
+			cmds = append(cmds, m.startFilter())
+		case key.Matches(msg, m.Keymap.Mark):
+			if m.Marked == m.CurNode {
+				m.Marked = nil
+			} else {
+				m.Marked = m.CurNode
+			}
+		}
+
 		debug(fmt.Sprintf("Pressed Key: %s\n", msg.String()))
 		// Cool, what was the actual key pressed?
 		switch msg.String() {
@@ -77,34 +225,35 @@ func (m *TreeModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 
 		case "up":
-			if m.CurNode.Idx == 0 {
-				if m.CurNode.Parent != nil && m.CurNode.Parent.Parent != nil {
-					m.CurNode = m.CurNode.Parent
-				}
-			} else {
-				m.CurNode = m.CurNode.Parent.children[m.CurNode.Idx-1]
+			if prev := sibling(m.CurNode, -1); prev != nil {
+				m.CurNode = prev
+			} else if parent := m.CurNode.viewParent(); parent != nil && parent.Parent != nil {
+				m.CurNode = parent
 			}
 		case "down":
-			if m.CurNode.Parent != nil && m.CurNode.Idx >= len(m.CurNode.Parent.children)-1 {
-				// See if our parent has a sibling that we can traverse to.
-				closestRelative := findClosestRelative(m.CurNode)
-				if closestRelative == nil {
-					break
-				}
-				m.CurNode = closestRelative
+			// If we are the last child, see if our parent has a sibling that
+			// we can traverse to.
+			closestRelative := findClosestRelative(m.CurNode)
+			if closestRelative == nil {
 				break
 			}
-			m.CurNode = m.CurNode.Parent.children[m.CurNode.Idx+1]
+			m.CurNode = closestRelative
 		case "right":
-			if len(m.CurNode.children) == 0 {
+			if m.CurNode.collapsed {
+				m.CurNode.SetCollapsed(false)
+				break
+			}
+			children := m.CurNode.visibleChildren()
+			if len(children) == 0 {
 				break
 			}
-			m.CurNode = m.CurNode.children[0]
+			m.CurNode = children[0]
 		case "left":
-			if m.CurNode.Parent == nil || m.CurNode.Parent.Parent == nil {
+			parent := m.CurNode.viewParent()
+			if parent == nil || parent.Parent == nil {
 				break
 			}
-			m.CurNode = m.CurNode.Parent
+			m.CurNode = parent
 		}
 
 	}
@@ -113,12 +262,23 @@ func (m *TreeModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+// Path returns the path between the marked node and the selection, or nil
+// if no other node is marked.
+func (m *TreeModel) Path() *Path {
+	if m.Marked == nil || m.Marked == m.CurNode {
+		return nil
+	}
+	path := NewPath(m.Marked, m.CurNode)
+	return &path
+}
+
 func (m *TreeModel) View() string {
+	m.path = m.Path()
 	t := tree.Root(m.Root.Name).
 		Enumerator(tree.DefaultEnumerator).
 		EnumeratorStyle(enumeratorStyle).
 		RootStyle(rootStyle).
 		ItemStyleFunc(itemStyleFunc).
-		Child(m.Root.children)
+		Child(m.Root.Children())
 	return t.String()
 }
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestInitEmptySnapshot(t *testing.T) {
+	m := NewTreeModel()
+	Snapshot{SchemaVersion: 1}.Build(m)
+	m.Init()
+	if m.CurNode != m.Root {
+		t.Fatalf("selected %v in an empty tree, want the root", m.CurNode)
+	}
+	for _, key := range []tea.KeyType{tea.KeyUp, tea.KeyDown, tea.KeyLeft, tea.KeyRight, tea.KeySpace} {
+		m.Update(tea.KeyMsg{Type: key})
+	}
+	if m.CurNode != m.Root {
+		t.Errorf("selected %v after moving around an empty tree", m.CurNode)
+	}
+	m.View()
+}
+
+func TestInitEverythingFilteredOut(t *testing.T) {
+	m := newWatchTree(watchDevice{"0000:01:00.0", "0000:00:01.0", 0})
+	f, err := ParseFilter("class=storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetFilter(f)
+	m.Init()
+	if m.CurNode != m.Root {
+		t.Fatalf("selected %v with every device filtered out, want the root", m.CurNode)
+	}
+
+	// The first device is selected once the filter shows one.
+	m.SetFilter(nil)
+	if want := m.Root.children[0]; m.CurNode != want {
+		t.Errorf("selected %v after clearing the filter, want %v", m.CurNode, want)
+	}
+}
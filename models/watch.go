@@ -0,0 +1,201 @@
+package models
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+var flashDuration = 2 * time.Second
+
+// A Scanner produces a fresh copy of the topology. In watch mode the tree
+// periodically rescans and splices the differences into itself, so the
+// scanner decides how changes are detected. The returned node is the root
+// of a tree built on any TreeModel.
+type Scanner interface {
+	Scan() (*Node, error)
+}
+
+// ScannerFunc adapts a function to the Scanner interface.
+type ScannerFunc func() (*Node, error)
+
+func (f ScannerFunc) Scan() (*Node, error) {
+	return f()
+}
+
+// watchMsg is implemented by the messages used by watch mode. They are
+// routed to the tree regardless of which view has focus.
+type watchMsg interface {
+	watch()
+}
+
+type rescanTickMsg struct{}
+type rescannedMsg struct {
+	root *Node
+	err  error
+}
+type flashDoneMsg struct{}
+
+func (rescanTickMsg) watch() {}
+func (rescannedMsg) watch()  {}
+func (flashDoneMsg) watch()  {}
+
+// Watch keeps the tree in sync with the system by calling scanner every
+// interval. It must be called before Init.
+func (m *TreeModel) Watch(scanner Scanner, interval time.Duration) {
+	m.scanner = scanner
+	m.watchInterval = interval
+}
+
+// Watching reports whether watch mode is enabled.
+func (m *TreeModel) Watching() bool {
+	return m.scanner != nil
+}
+
+func (m *TreeModel) scheduleRescan() tea.Cmd {
+	return tea.Tick(m.watchInterval, func(time.Time) tea.Msg {
+		return rescanTickMsg{}
+	})
+}
+
+func (m *TreeModel) updateWatch(msg watchMsg) tea.Cmd {
+	switch msg := msg.(type) {
+	case rescanTickMsg:
+		scanner := m.scanner
+		return func() tea.Msg {
+			root, err := scanner.Scan()
+			return rescannedMsg{root: root, err: err}
+		}
+	case rescannedMsg:
+		m.WatchErr = msg.err
+		if msg.err != nil {
+			return m.scheduleRescan()
+		}
+		if len(m.Sync(msg.root)) == 0 {
+			return m.scheduleRescan()
+		}
+		return tea.Batch(
+			m.scheduleRescan(),
+			tea.Tick(flashDuration, func(time.Time) tea.Msg {
+				return flashDoneMsg{}
+			}),
+		)
+	}
+	// flashDoneMsg only needs to cause a render.
+	return nil
+}
+
+// nodeKey identifies a node across scans. Root buses found through sysfs
+// have no bus address, but their handle is unique.
+func nodeKey(n *Node) string {
+	if n.Detail.Businfo != "" {
+		return n.Detail.Businfo
+	}
+	return n.Detail.Handle
+}
+
+func indexByKey(root *Node) map[string]*Node {
+	index := map[string]*Node{}
+	for _, child := range root.children {
+		child.Walk(func(n *Node) bool {
+			index[nodeKey(n)] = n
+			return true
+		})
+	}
+	return index
+}
+
+// neighbour returns the sibling closest after n that survives, or else the
+// closest one before it, or n's parent if no sibling survives.
+func neighbour(n *Node, survives func(*Node) bool) *Node {
+	siblings := n.Parent.children
+	for i := n.Idx + 1; i < len(siblings); i++ {
+		if survives(siblings[i]) {
+			return siblings[i]
+		}
+	}
+	for i := n.Idx - 1; i >= 0; i-- {
+		if survives(siblings[i]) {
+			return siblings[i]
+		}
+	}
+	return n.Parent
+}
+
+// Sync splices fresh, the root of a newly scanned topology, into the tree.
+// Nodes that still exist are updated in place, so the selection is
+// preserved unless the selected device disappeared, in which case the
+// closest surviving device beside it, or else its parent, is selected.
+// Nodes that were added, moved or whose link, NUMA node or driver changed
+// flash for a moment. The changes are returned.
+func (m *TreeModel) Sync(fresh *Node) []Change {
+	changes := Diff(m.Root, fresh)
+	live := indexByKey(m.Root)
+	next := indexByKey(fresh)
+
+	survives := func(n *Node) bool {
+		_, ok := next[nodeKey(n)]
+		return ok
+	}
+	// Removing nodes during the walk would shift the children it is
+	// iterating over, so they are collected first.
+	removed := []*Node{}
+	for _, child := range m.Root.children {
+		child.Walk(func(n *Node) bool {
+			if survives(n) {
+				return true
+			}
+			removed = append(removed, n)
+			return false
+		})
+	}
+	for _, n := range removed {
+		if m.CurNode != nil && m.CurNode.IsDescendantOf(n) {
+			m.CurNode = neighbour(n, survives)
+		}
+	}
+	for _, n := range removed {
+		n.Parent.removeChild(n)
+		delete(live, nodeKey(n))
+	}
+
+	for _, child := range fresh.children {
+		child.Walk(func(f *Node) bool {
+			parent := m.Root
+			if f.Parent != fresh {
+				parent = live[nodeKey(f.Parent)]
+			}
+			n, ok := live[nodeKey(f)]
+			if !ok {
+				n = NewNode(f.Name, f.Detail, parent, m)
+				parent.insertChild(n, f.Idx)
+				live[nodeKey(f)] = n
+				return true
+			}
+			n.setDetail(f.Detail)
+			if n.Parent != parent {
+				n.Parent.removeChild(n)
+				parent.insertChild(n, f.Idx)
+			}
+			return true
+		})
+	}
+
+	GroupVirtualFunctions(m.Root)
+
+	flashUntil := time.Now().Add(flashDuration)
+	for _, c := range changes {
+		if n, ok := live[c.Businfo]; ok {
+			n.flashUntil = flashUntil
+		}
+	}
+	m.refilter()
+	m.pruneSearch()
+	if m.Marked != nil && !m.Marked.IsDescendantOf(m.Root) {
+		m.Marked = nil
+	}
+	if m.CurNode == m.Root {
+		m.CurNode = m.firstVisible()
+	}
+	return changes
+}
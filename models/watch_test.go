@@ -0,0 +1,138 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/LandonTClipp/pciex/pcie"
+)
+
+// watchDevice is a device of a topology built by newWatchTree.
+type watchDevice struct {
+	address string
+	parent  string
+	numa    int
+}
+
+// newWatchTree builds a root complex with the root ports 0000:00:01.0 and
+// 0000:00:02.0 and the given devices behind them.
+func newWatchTree(devices ...watchDevice) *TreeModel {
+	tree := NewTreeModel()
+	tree.Root = NewNode("root", pcie.Details{}, nil, tree)
+	rc := tree.Root.AddChild("rc", pcie.Details{Class: "bridge", Handle: "PCIBUS:0000:00"})
+	byAddress := map[string]*Node{
+		"0000:00:01.0": addDevice(rc, "0000:00:01.0", "bridge"),
+		"0000:00:02.0": addDevice(rc, "0000:00:02.0", "bridge"),
+	}
+	for _, d := range devices {
+		n := addDevice(byAddress[d.parent], d.address, "display")
+		numa := d.numa
+		n.Detail.NumaNode = &numa
+		byAddress[d.address] = n
+	}
+	return tree
+}
+
+func addresses(nodes Children) []string {
+	out := []string{}
+	for _, n := range nodes {
+		out = append(out, n.Detail.Address())
+	}
+	return out
+}
+
+func TestSync(t *testing.T) {
+	live := newWatchTree(
+		watchDevice{"0000:01:00.0", "0000:00:01.0", 0},
+		watchDevice{"0000:01:00.1", "0000:00:01.0", 0},
+		watchDevice{"0000:02:00.0", "0000:00:02.0", 0},
+	)
+	selected := live.Root.FindByAddress("0000:02:00.0")
+	changed := live.Root.FindByAddress("0000:01:00.0")
+	live.CurNode = selected
+
+	fresh := newWatchTree(
+		watchDevice{"0000:01:00.0", "0000:00:01.0", 1},
+		watchDevice{"0000:01:00.2", "0000:00:01.0", 0},
+		watchDevice{"0000:02:00.0", "0000:00:02.0", 0},
+	)
+	changes := live.Sync(fresh.Root)
+
+	want := []Change{
+		{Kind: ChangeNUMA, Businfo: "pci@0000:01:00.0", Before: "0", After: "1"},
+		{Kind: ChangeRemoved, Businfo: "pci@0000:01:00.1"},
+		{Kind: ChangeAdded, Businfo: "pci@0000:01:00.2"},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("got changes %v, want %v", changes, want)
+	}
+	for i, c := range changes {
+		if c.Kind != want[i].Kind || c.Businfo != want[i].Businfo || c.Before != want[i].Before || c.After != want[i].After {
+			t.Errorf("change %d = %v, want %v", i, c, want[i])
+		}
+	}
+
+	rootPort := live.Root.FindByAddress("0000:00:01.0")
+	if got := addresses(rootPort.children); len(got) != 2 || got[0] != "0000:01:00.0" || got[1] != "0000:01:00.2" {
+		t.Errorf("devices behind the root port = %v, want 0000:01:00.0 and 0000:01:00.2", got)
+	}
+	if live.Root.FindByAddress("0000:01:00.0") != changed {
+		t.Error("the changed device was replaced instead of updated in place")
+	}
+	if *changed.Detail.NumaNode != 1 {
+		t.Errorf("numa_node of the changed device = %d, want 1", *changed.Detail.NumaNode)
+	}
+	if changed.flashUntil.IsZero() || live.Root.FindByAddress("0000:01:00.2").flashUntil.IsZero() {
+		t.Error("the changed and added devices don't flash")
+	}
+	if live.CurNode != selected {
+		t.Errorf("selection moved to %s", live.CurNode.Detail.Businfo)
+	}
+	if len(live.Sync(newWatchTree(
+		watchDevice{"0000:01:00.0", "0000:00:01.0", 1},
+		watchDevice{"0000:01:00.2", "0000:00:01.0", 0},
+		watchDevice{"0000:02:00.0", "0000:00:02.0", 0},
+	).Root)) != 0 {
+		t.Error("syncing the same topology again reported changes")
+	}
+}
+
+func TestSyncRemovedSelection(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		selected string
+		after    []watchDevice
+		want     string
+	}{
+		{
+			name:     "next sibling",
+			selected: "0000:01:00.1",
+			after:    []watchDevice{{"0000:01:00.0", "0000:00:01.0", 0}, {"0000:01:00.2", "0000:00:01.0", 0}},
+			want:     "0000:01:00.2",
+		},
+		{
+			name:     "previous sibling",
+			selected: "0000:01:00.2",
+			after:    []watchDevice{{"0000:01:00.0", "0000:00:01.0", 0}, {"0000:01:00.1", "0000:00:01.0", 0}},
+			want:     "0000:01:00.1",
+		},
+		{
+			name:     "siblings removed too",
+			selected: "0000:01:00.1",
+			after:    []watchDevice{},
+			want:     "0000:00:01.0",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			live := newWatchTree(
+				watchDevice{"0000:01:00.0", "0000:00:01.0", 0},
+				watchDevice{"0000:01:00.1", "0000:00:01.0", 0},
+				watchDevice{"0000:01:00.2", "0000:00:01.0", 0},
+			)
+			live.CurNode = live.Root.FindByAddress(tt.selected)
+			live.Sync(newWatchTree(tt.after...).Root)
+			if got := live.CurNode.Detail.Address(); got != tt.want {
+				t.Errorf("selected %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/LandonTClipp/pciex/models"
+)
+
+func runPath(args []string) error {
+	opts := collectOptions{}
+	fs := newFlagSet("pciex path", "<address> <address>")
+	opts.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected exactly two device addresses")
+	}
+	tree, err := collectTree(opts)
+	if err != nil {
+		return err
+	}
+	nodes := []*models.Node{}
+	for _, address := range fs.Args() {
+		node := tree.Root.FindByAddress(address)
+		if node == nil {
+			return fmt.Errorf("no device with address %s", address)
+		}
+		nodes = append(nodes, node)
+	}
+	fmt.Print(models.NewPath(nodes[0], nodes[1]).String())
+	return nil
+}
@@ -0,0 +1,189 @@
+package pcie
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chigopher/pathlib"
+)
+
+// AERErrors are the errors of one severity the kernel counted for a device
+// since boot, by type.
+type AERErrors struct {
+	Total uint64 `json:"total" yaml:"total"`
+	// Counts are keyed by the names the kernel uses, such as RxErr or
+	// MalfTLP. Types that never occurred are left out.
+	Counts map[string]uint64 `json:"counts,omitempty" yaml:"counts,omitempty"`
+}
+
+// AERRootPortErrors are the errors reported to a root port by the devices
+// below it.
+type AERRootPortErrors struct {
+	Correctable uint64 `json:"correctable" yaml:"correctable"`
+	NonFatal    uint64 `json:"nonfatal" yaml:"nonfatal"`
+	Fatal       uint64 `json:"fatal" yaml:"fatal"`
+}
+
+// AERCounters are the Advanced Error Reporting counters of a device.
+type AERCounters struct {
+	Correctable *AERErrors         `json:"correctable,omitempty" yaml:"correctable,omitempty"`
+	NonFatal    *AERErrors         `json:"nonfatal,omitempty" yaml:"nonfatal,omitempty"`
+	Fatal       *AERErrors         `json:"fatal,omitempty" yaml:"fatal,omitempty"`
+	RootPort    *AERRootPortErrors `json:"root_port,omitempty" yaml:"root_port,omitempty"`
+}
+
+func (e *AERErrors) total() uint64 {
+	if e == nil {
+		return 0
+	}
+	return e.Total
+}
+
+// Total is the number of errors of every severity the device reported
+// itself, not counting the ones a root port received from below.
+func (c *AERCounters) Total() uint64 {
+	if c == nil {
+		return 0
+	}
+	return c.Correctable.total() + c.NonFatal.total() + c.Fatal.total()
+}
+
+// HasErrors reports whether the device or, for root ports, any device
+// below it reported an error.
+func (c *AERCounters) HasErrors() bool {
+	if c == nil {
+		return false
+	}
+	if c.Total() > 0 {
+		return true
+	}
+	r := c.RootPort
+	return r != nil && r.Correctable+r.NonFatal+r.Fatal > 0
+}
+
+// String breaks the errors down by severity and type.
+func (c *AERCounters) String() string {
+	var b strings.Builder
+	b.WriteString("AER errors:\n")
+	for _, severity := range []struct {
+		name   string
+		errors *AERErrors
+	}{
+		{"correctable", c.Correctable},
+		{"nonfatal", c.NonFatal},
+		{"fatal", c.Fatal},
+	} {
+		if severity.errors == nil {
+			continue
+		}
+		fmt.Fprintf(&b, "  %-12s %d", severity.name, severity.errors.Total)
+		names := []string{}
+		for name := range severity.errors.Counts {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			ci, cj := severity.errors.Counts[names[i]], severity.errors.Counts[names[j]]
+			if ci != cj {
+				return ci > cj
+			}
+			return names[i] < names[j]
+		})
+		counts := []string{}
+		for _, name := range names {
+			counts = append(counts, fmt.Sprintf("%s %d", name, severity.errors.Counts[name]))
+		}
+		if len(counts) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(counts, ", "))
+		}
+		b.WriteString("\n")
+	}
+	if r := c.RootPort; r != nil {
+		fmt.Fprintf(&b, "  reported to this root port: %d correctable, %d nonfatal, %d fatal\n", r.Correctable, r.NonFatal, r.Fatal)
+	}
+	return b.String()
+}
+
+// readAERErrors reads one of the aer_dev_* attributes, which list a count
+// per error type followed by a TOTAL_ERR_* line. A nil value is returned if
+// the attribute does not exist.
+func readAERErrors(sysfsPath *pathlib.Path, name string) (*AERErrors, error) {
+	b, err := sysfsPath.Join(name).ReadFile()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	e := &AERErrors{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		count, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", name, err)
+		}
+		switch {
+		case strings.HasPrefix(fields[0], "TOTAL_ERR_"):
+			e.Total = count
+		case count > 0:
+			if e.Counts == nil {
+				e.Counts = map[string]uint64{}
+			}
+			e.Counts[fields[0]] = count
+		}
+	}
+	return e, nil
+}
+
+// readAERCounters reads the AER counters the kernel keeps in sysfs. A nil
+// value is returned if the device doesn't have AER or the kernel doesn't
+// expose the counters.
+func readAERCounters(sysfsPath *pathlib.Path) (*AERCounters, error) {
+	c := &AERCounters{}
+	var err error
+	if c.Correctable, err = readAERErrors(sysfsPath, "aer_dev_correctable"); err != nil {
+		return nil, err
+	}
+	if c.NonFatal, err = readAERErrors(sysfsPath, "aer_dev_nonfatal"); err != nil {
+		return nil, err
+	}
+	if c.Fatal, err = readAERErrors(sysfsPath, "aer_dev_fatal"); err != nil {
+		return nil, err
+	}
+
+	rootPort := AERRootPortErrors{}
+	foundRootPort := false
+	for _, total := range []struct {
+		name string
+		dst  *uint64
+	}{
+		{"aer_rootport_total_err_cor", &rootPort.Correctable},
+		{"aer_rootport_total_err_nonfatal", &rootPort.NonFatal},
+		{"aer_rootport_total_err_fatal", &rootPort.Fatal},
+	} {
+		v, err := readSysfsInt(sysfsPath, total.name)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			foundRootPort = true
+			*total.dst = uint64(*v)
+		}
+	}
+	if foundRootPort {
+		c.RootPort = &rootPort
+	}
+
+	if c.Correctable == nil && c.NonFatal == nil && c.Fatal == nil && c.RootPort == nil {
+		return nil, nil
+	}
+	return c, nil
+}
@@ -0,0 +1,531 @@
+package pcie
+
+import (
+	"fmt"
+	"strings"
+)
+
+var capabilityNames = map[uint8]string{
+	0x01: "Power Management",
+	0x02: "AGP",
+	0x03: "Vital Product Data",
+	0x04: "Slot Identification",
+	0x05: "MSI",
+	0x06: "CompactPCI Hot Swap",
+	0x07: "PCI-X",
+	0x08: "HyperTransport",
+	0x09: "Vendor Specific",
+	0x0a: "Debug Port",
+	0x0b: "CompactPCI Central Resource Control",
+	0x0c: "PCI Hot-Plug",
+	0x0d: "Bridge Subsystem Vendor ID",
+	0x0e: "AGP 8x",
+	0x0f: "Secure Device",
+	0x10: "PCI Express",
+	0x11: "MSI-X",
+	0x12: "SATA Data/Index Configuration",
+	0x13: "Advanced Features",
+	0x14: "Enhanced Allocation",
+	0x15: "Flattening Portal Bridge",
+}
+
+var extendedCapabilityNames = map[uint16]string{
+	0x0001: "Advanced Error Reporting",
+	0x0002: "Virtual Channel",
+	0x0003: "Device Serial Number",
+	0x0004: "Power Budgeting",
+	0x0005: "Root Complex Link Declaration",
+	0x0006: "Root Complex Internal Link Control",
+	0x0007: "Root Complex Event Collector Endpoint Association",
+	0x0008: "Multi-Function Virtual Channel",
+	0x0009: "Virtual Channel",
+	0x000a: "Root Complex Register Block Header",
+	0x000b: "Vendor Specific",
+	0x000c: "Configuration Access Correlation",
+	0x000d: "Access Control Services",
+	0x000e: "Alternative Routing-ID Interpretation",
+	0x000f: "Address Translation Services",
+	0x0010: "Single Root I/O Virtualization",
+	0x0011: "Multi-Root I/O Virtualization",
+	0x0012: "Multicast",
+	0x0013: "Page Request Interface",
+	0x0015: "Resizable BAR",
+	0x0016: "Dynamic Power Allocation",
+	0x0017: "TPH Requester",
+	0x0018: "Latency Tolerance Reporting",
+	0x0019: "Secondary PCI Express",
+	0x001a: "Protocol Multiplexing",
+	0x001b: "Process Address Space ID",
+	0x001c: "LN Requester",
+	0x001d: "Downstream Port Containment",
+	0x001e: "L1 PM Substates",
+	0x001f: "Precision Time Measurement",
+	0x0020: "M-PCIe",
+	0x0021: "FRS Queueing",
+	0x0022: "Readiness Time Reporting",
+	0x0023: "Designated Vendor-Specific",
+	0x0024: "VF Resizable BAR",
+	0x0025: "Data Link Feature",
+	0x0026: "Physical Layer 16.0 GT/s",
+	0x0027: "Lane Margining at the Receiver",
+	0x0028: "Hierarchy ID",
+	0x0029: "Native PCIe Enclosure Management",
+	0x002a: "Physical Layer 32.0 GT/s",
+	0x002b: "Alternate Protocol",
+	0x002c: "System Firmware Intermediary",
+	0x002d: "Shadow Functions",
+	0x002e: "Data Object Exchange",
+	0x002f: "Device 3",
+	0x0030: "Integrity and Data Encryption",
+	0x0031: "Physical Layer 64.0 GT/s",
+	0x0032: "Flit Logging",
+}
+
+// Capability is an entry of the legacy capability list. At most one of the
+// typed fields is set, depending on ID.
+type Capability struct {
+	ID              uint8                      `json:"id" yaml:"id"`
+	Name            string                     `json:"name" yaml:"name"`
+	Offset          Offset                     `json:"offset" yaml:"offset"`
+	PowerManagement *PowerManagementCapability `json:"power_management,omitempty" yaml:"power_management,omitempty"`
+	MSI             *MSICapability             `json:"msi,omitempty" yaml:"msi,omitempty"`
+	MSIX            *MSIXCapability            `json:"msix,omitempty" yaml:"msix,omitempty"`
+	Express         *ExpressCapability         `json:"express,omitempty" yaml:"express,omitempty"`
+	VendorSpecific  *VendorSpecificCapability  `json:"vendor_specific,omitempty" yaml:"vendor_specific,omitempty"`
+	SubsystemID     *BridgeSubsystemCapability `json:"subsystem_id,omitempty" yaml:"subsystem_id,omitempty"`
+}
+
+// ExtendedCapability is an entry of the extended capability list, which
+// starts at offset 0x100 of PCI Express config space.
+type ExtendedCapability struct {
+	ID                 uint16           `json:"id" yaml:"id"`
+	Version            uint8            `json:"version" yaml:"version"`
+	Name               string           `json:"name" yaml:"name"`
+	Offset             Offset           `json:"offset" yaml:"offset"`
+	DeviceSerialNumber string           `json:"device_serial_number,omitempty" yaml:"device_serial_number,omitempty"`
+	ACS                *ACSCapability   `json:"acs,omitempty" yaml:"acs,omitempty"`
+	SRIOV              *SRIOVCapability `json:"sriov,omitempty" yaml:"sriov,omitempty"`
+	AER                *AERCapability   `json:"aer,omitempty" yaml:"aer,omitempty"`
+}
+
+func capabilityName(id uint8) string {
+	if name, ok := capabilityNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown (0x%02x)", id)
+}
+
+func extendedCapabilityName(id uint16) string {
+	if name, ok := extendedCapabilityNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown (0x%04x)", id)
+}
+
+func parseCapability(r configReader, offset int) Capability {
+	id := r.u8(offset)
+	c := Capability{
+		ID:     id,
+		Name:   capabilityName(id),
+		Offset: Offset(offset),
+	}
+	switch id {
+	case 0x01:
+		if r.has(offset, 8) {
+			c.PowerManagement = parsePowerManagement(r, offset)
+		}
+	case 0x05:
+		if r.has(offset, 4) {
+			c.MSI = parseMSI(r, offset)
+		}
+	case 0x09:
+		if r.has(offset, 3) {
+			c.VendorSpecific = &VendorSpecificCapability{Length: r.u8(offset + 2)}
+		}
+	case 0x0d:
+		if r.has(offset, 8) {
+			c.SubsystemID = &BridgeSubsystemCapability{
+				SubsystemVendorID: ID(r.u16(offset + 4)),
+				SubsystemID:       ID(r.u16(offset + 6)),
+			}
+		}
+	case 0x10:
+		if r.has(offset, 0x14) {
+			c.Express = parseExpress(r, offset)
+		}
+	case 0x11:
+		if r.has(offset, 12) {
+			c.MSIX = parseMSIX(r, offset)
+		}
+	}
+	return c
+}
+
+func parseExtendedCapability(r configReader, offset int) ExtendedCapability {
+	header := r.u32(offset)
+	id := uint16(header)
+	c := ExtendedCapability{
+		ID:      id,
+		Version: uint8(header>>16) & 0xf,
+		Name:    extendedCapabilityName(id),
+		Offset:  Offset(offset),
+	}
+	switch id {
+	case 0x0001:
+		if r.has(offset, 0x18) {
+			c.AER = parseAER(r, offset)
+		}
+	case 0x0003:
+		if r.has(offset, 12) {
+			c.DeviceSerialNumber = formatSerialNumber(r.u64(offset + 4))
+		}
+	case 0x000d:
+		if r.has(offset, 8) {
+			c.ACS = parseACS(r, offset)
+		}
+	case 0x0010:
+		if r.has(offset, 0x1c) {
+			c.SRIOV = parseSRIOV(r, offset)
+		}
+	}
+	return c
+}
+
+// formatSerialNumber formats a Device Serial Number the way lspci does,
+// most significant byte first.
+func formatSerialNumber(serial uint64) string {
+	parts := make([]string, 8)
+	for i := range parts {
+		parts[i] = fmt.Sprintf("%02x", uint8(serial>>(8*(7-i))))
+	}
+	return strings.Join(parts, "-")
+}
+
+// ACSFlags are the bits shared by the ACS Capability and ACS Control
+// registers.
+type ACSFlags struct {
+	SourceValidation    bool `json:"source_validation" yaml:"source_validation"`
+	TranslationBlocking bool `json:"translation_blocking" yaml:"translation_blocking"`
+	RequestRedirect     bool `json:"p2p_request_redirect" yaml:"p2p_request_redirect"`
+	CompletionRedirect  bool `json:"p2p_completion_redirect" yaml:"p2p_completion_redirect"`
+	UpstreamForwarding  bool `json:"upstream_forwarding" yaml:"upstream_forwarding"`
+	EgressControl       bool `json:"p2p_egress_control" yaml:"p2p_egress_control"`
+	DirectTranslated    bool `json:"direct_translated_p2p" yaml:"direct_translated_p2p"`
+}
+
+func parseACSFlags(v uint16) ACSFlags {
+	return ACSFlags{
+		SourceValidation:    v&(1<<0) != 0,
+		TranslationBlocking: v&(1<<1) != 0,
+		RequestRedirect:     v&(1<<2) != 0,
+		CompletionRedirect:  v&(1<<3) != 0,
+		UpstreamForwarding:  v&(1<<4) != 0,
+		EgressControl:       v&(1<<5) != 0,
+		DirectTranslated:    v&(1<<6) != 0,
+	}
+}
+
+// ACSCapability is the Access Control Services extended capability.
+// Capabilities is what the port supports and Control is what is enabled.
+type ACSCapability struct {
+	Capabilities ACSFlags `json:"capabilities" yaml:"capabilities"`
+	Control      ACSFlags `json:"control" yaml:"control"`
+}
+
+func parseACS(r configReader, offset int) *ACSCapability {
+	return &ACSCapability{
+		Capabilities: parseACSFlags(r.u16(offset + 4)),
+		Control:      parseACSFlags(r.u16(offset + 6)),
+	}
+}
+
+// aerUncorrectableErrors and aerCorrectableErrors name the bits of the AER
+// status, mask and severity registers the way the kernel's aer_dev_*
+// counters do.
+var (
+	aerUncorrectableErrors = map[int]string{
+		4:  "DLP",
+		5:  "SDES",
+		12: "TLP",
+		13: "FCP",
+		14: "CmpltTO",
+		15: "CmpltAbrt",
+		16: "UnxCmplt",
+		17: "RxOF",
+		18: "MalfTLP",
+		19: "ECRC",
+		20: "UnsupReq",
+		21: "ACSViol",
+		22: "UncorrIntErr",
+		23: "BlockedTLP",
+		24: "AtomicOpBlocked",
+		25: "TLPBlockedErr",
+		26: "PoisonTLPBlocked",
+	}
+	aerCorrectableErrors = map[int]string{
+		0:  "RxErr",
+		6:  "BadTLP",
+		7:  "BadDLLP",
+		8:  "Rollover",
+		12: "Timeout",
+		13: "NonFatalErr",
+		14: "CorrIntErr",
+		15: "HeaderOF",
+	}
+)
+
+// aerBits returns the names of the bits set in v.
+func aerBits(v uint32, names map[int]string) []string {
+	set := []string{}
+	for bit := 0; bit < 32; bit++ {
+		if v&(1<<bit) == 0 {
+			continue
+		}
+		if name, ok := names[bit]; ok {
+			set = append(set, name)
+		} else {
+			set = append(set, fmt.Sprintf("bit%d", bit))
+		}
+	}
+	return set
+}
+
+// AERCapability is the Advanced Error Reporting extended capability. Each
+// field lists the errors whose bit is set in the register: Status are the
+// errors that occurred and haven't been cleared, Mask are the errors that
+// aren't reported, and UncorrectableFatal are the uncorrectable errors
+// treated as fatal rather than nonfatal.
+type AERCapability struct {
+	UncorrectableStatus []string `json:"uncorrectable_status" yaml:"uncorrectable_status"`
+	UncorrectableMask   []string `json:"uncorrectable_mask" yaml:"uncorrectable_mask"`
+	UncorrectableFatal  []string `json:"uncorrectable_fatal" yaml:"uncorrectable_fatal"`
+	CorrectableStatus   []string `json:"correctable_status" yaml:"correctable_status"`
+	CorrectableMask     []string `json:"correctable_mask" yaml:"correctable_mask"`
+}
+
+func parseAER(r configReader, offset int) *AERCapability {
+	return &AERCapability{
+		UncorrectableStatus: aerBits(r.u32(offset+0x04), aerUncorrectableErrors),
+		UncorrectableMask:   aerBits(r.u32(offset+0x08), aerUncorrectableErrors),
+		UncorrectableFatal:  aerBits(r.u32(offset+0x0c), aerUncorrectableErrors),
+		CorrectableStatus:   aerBits(r.u32(offset+0x10), aerCorrectableErrors),
+		CorrectableMask:     aerBits(r.u32(offset+0x14), aerCorrectableErrors),
+	}
+}
+
+// SRIOVCapability is the Single Root I/O Virtualization extended capability
+// of a physical function. The routing ID of the n'th VF, counting from 1, is
+// the PF's routing ID plus FirstVFOffset plus (n-1) times VFStride.
+type SRIOVCapability struct {
+	TotalVFs      uint16 `json:"total_vfs" yaml:"total_vfs"`
+	InitialVFs    uint16 `json:"initial_vfs" yaml:"initial_vfs"`
+	NumVFs        uint16 `json:"num_vfs" yaml:"num_vfs"`
+	VFEnable      bool   `json:"vf_enable" yaml:"vf_enable"`
+	FirstVFOffset uint16 `json:"first_vf_offset" yaml:"first_vf_offset"`
+	VFStride      uint16 `json:"vf_stride" yaml:"vf_stride"`
+	VFDeviceID    ID     `json:"vf_device_id" yaml:"vf_device_id"`
+}
+
+func parseSRIOV(r configReader, offset int) *SRIOVCapability {
+	return &SRIOVCapability{
+		VFEnable:      r.u16(offset+0x08)&1 != 0,
+		InitialVFs:    r.u16(offset + 0x0c),
+		TotalVFs:      r.u16(offset + 0x0e),
+		NumVFs:        r.u16(offset + 0x10),
+		FirstVFOffset: r.u16(offset + 0x14),
+		VFStride:      r.u16(offset + 0x16),
+		VFDeviceID:    ID(r.u16(offset + 0x1a)),
+	}
+}
+
+type PowerManagementCapability struct {
+	Version    uint8  `json:"version" yaml:"version"`
+	PMESupport string `json:"pme_support" yaml:"pme_support"`
+	PowerState string `json:"power_state" yaml:"power_state"`
+}
+
+func parsePowerManagement(r configReader, offset int) *PowerManagementCapability {
+	pmc := r.u16(offset + 2)
+	pmcsr := r.u16(offset + 4)
+	states := []string{}
+	for i, state := range []string{"D0", "D1", "D2", "D3hot", "D3cold"} {
+		if pmc&(1<<(11+i)) != 0 {
+			states = append(states, state)
+		}
+	}
+	return &PowerManagementCapability{
+		Version:    uint8(pmc & 0x7),
+		PMESupport: strings.Join(states, ","),
+		PowerState: []string{"D0", "D1", "D2", "D3hot"}[pmcsr&0x3],
+	}
+}
+
+type MSICapability struct {
+	Enabled          bool `json:"enabled" yaml:"enabled"`
+	Address64        bool `json:"address_64" yaml:"address_64"`
+	PerVectorMasking bool `json:"per_vector_masking" yaml:"per_vector_masking"`
+	VectorsCapable   int  `json:"vectors_capable" yaml:"vectors_capable"`
+	VectorsEnabled   int  `json:"vectors_enabled" yaml:"vectors_enabled"`
+}
+
+func parseMSI(r configReader, offset int) *MSICapability {
+	control := r.u16(offset + 2)
+	return &MSICapability{
+		Enabled:          control&0x1 != 0,
+		VectorsCapable:   1 << ((control >> 1) & 0x7),
+		VectorsEnabled:   1 << ((control >> 4) & 0x7),
+		Address64:        control&(1<<7) != 0,
+		PerVectorMasking: control&(1<<8) != 0,
+	}
+}
+
+type MSIXCapability struct {
+	Enabled      bool   `json:"enabled" yaml:"enabled"`
+	FunctionMask bool   `json:"function_mask" yaml:"function_mask"`
+	TableSize    int    `json:"table_size" yaml:"table_size"`
+	TableBAR     uint8  `json:"table_bar" yaml:"table_bar"`
+	TableOffset  uint32 `json:"table_offset" yaml:"table_offset"`
+	PBABAR       uint8  `json:"pba_bar" yaml:"pba_bar"`
+	PBAOffset    uint32 `json:"pba_offset" yaml:"pba_offset"`
+}
+
+func parseMSIX(r configReader, offset int) *MSIXCapability {
+	control := r.u16(offset + 2)
+	table := r.u32(offset + 4)
+	pba := r.u32(offset + 8)
+	return &MSIXCapability{
+		Enabled:      control&(1<<15) != 0,
+		FunctionMask: control&(1<<14) != 0,
+		TableSize:    int(control&0x7ff) + 1,
+		TableBAR:     uint8(table & 0x7),
+		TableOffset:  table &^ 0x7,
+		PBABAR:       uint8(pba & 0x7),
+		PBAOffset:    pba &^ 0x7,
+	}
+}
+
+type VendorSpecificCapability struct {
+	Length uint8 `json:"length" yaml:"length"`
+}
+
+type BridgeSubsystemCapability struct {
+	SubsystemVendorID ID `json:"subsystem_vendor_id" yaml:"subsystem_vendor_id"`
+	SubsystemID       ID `json:"subsystem_id" yaml:"subsystem_id"`
+}
+
+// PortType is the Device/Port Type field of the PCI Express Capabilities
+// register.
+type PortType uint8
+
+const (
+	PortTypeEndpoint            PortType = 0x0
+	PortTypeLegacyEndpoint      PortType = 0x1
+	PortTypeRootPort            PortType = 0x4
+	PortTypeUpstream            PortType = 0x5
+	PortTypeDownstream          PortType = 0x6
+	PortTypePCIEToPCIBridge     PortType = 0x7
+	PortTypePCIToPCIEBridge     PortType = 0x8
+	PortTypeRootComplexEndpoint PortType = 0x9
+	PortTypeEventCollector      PortType = 0xa
+)
+
+var portTypeNames = map[PortType]string{
+	PortTypeEndpoint:            "Endpoint",
+	PortTypeLegacyEndpoint:      "Legacy Endpoint",
+	PortTypeRootPort:            "Root Port",
+	PortTypeUpstream:            "Upstream Port",
+	PortTypeDownstream:          "Downstream Port",
+	PortTypePCIEToPCIBridge:     "PCI Express to PCI/PCI-X Bridge",
+	PortTypePCIToPCIEBridge:     "PCI/PCI-X to PCI Express Bridge",
+	PortTypeRootComplexEndpoint: "Root Complex Integrated Endpoint",
+	PortTypeEventCollector:      "Root Complex Event Collector",
+}
+
+func (p PortType) String() string {
+	if name, ok := portTypeNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown (0x%x)", uint8(p))
+}
+
+func (p PortType) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *PortType) UnmarshalText(b []byte) error {
+	for portType, name := range portTypeNames {
+		if name == string(b) {
+			*p = portType
+			return nil
+		}
+	}
+	var v uint8
+	if _, err := fmt.Sscanf(string(b), "Unknown (0x%x)", &v); err != nil {
+		return fmt.Errorf("parsing port type %q: %w", string(b), err)
+	}
+	*p = PortType(v)
+	return nil
+}
+
+var aspmNames = []string{"disabled", "L0s", "L1", "L0s L1"}
+
+type ExpressCapability struct {
+	Version                 uint8       `json:"version" yaml:"version"`
+	PortType                PortType    `json:"port_type" yaml:"port_type"`
+	SlotImplemented         bool        `json:"slot_implemented" yaml:"slot_implemented"`
+	PhysicalSlot            *uint16     `json:"physical_slot,omitempty" yaml:"physical_slot,omitempty"`
+	MaxPayloadSupported     int         `json:"max_payload_supported" yaml:"max_payload_supported"`
+	MaxPayload              int         `json:"max_payload" yaml:"max_payload"`
+	MaxReadRequest          int         `json:"max_read_request" yaml:"max_read_request"`
+	MaxLinkSpeed            LinkSpeed   `json:"max_link_speed" yaml:"max_link_speed"`
+	MaxLinkWidth            int         `json:"max_link_width" yaml:"max_link_width"`
+	SupportedLinkSpeeds     []LinkSpeed `json:"supported_link_speeds,omitempty" yaml:"supported_link_speeds,omitempty"`
+	ASPMSupport             string      `json:"aspm_support" yaml:"aspm_support"`
+	PortNumber              uint8       `json:"port_number" yaml:"port_number"`
+	ASPMControl             string      `json:"aspm_control" yaml:"aspm_control"`
+	CurrentLinkSpeed        LinkSpeed   `json:"current_link_speed" yaml:"current_link_speed"`
+	CurrentLinkWidth        int         `json:"current_link_width" yaml:"current_link_width"`
+	LinkTraining            bool        `json:"link_training" yaml:"link_training"`
+	DataLinkLayerLinkActive bool        `json:"data_link_layer_link_active" yaml:"data_link_layer_link_active"`
+}
+
+func parseExpress(r configReader, offset int) *ExpressCapability {
+	caps := r.u16(offset + 0x02)
+	devCaps := r.u32(offset + 0x04)
+	devControl := r.u16(offset + 0x08)
+	linkCaps := r.u32(offset + 0x0c)
+	linkControl := r.u16(offset + 0x10)
+	linkStatus := r.u16(offset + 0x12)
+
+	e := &ExpressCapability{
+		Version:                 uint8(caps & 0xf),
+		PortType:                PortType((caps >> 4) & 0xf),
+		SlotImplemented:         caps&(1<<8) != 0,
+		MaxPayloadSupported:     128 << (devCaps & 0x7),
+		MaxPayload:              128 << ((devControl >> 5) & 0x7),
+		MaxReadRequest:          128 << ((devControl >> 12) & 0x7),
+		MaxLinkSpeed:            LinkSpeed(linkCaps & 0xf),
+		MaxLinkWidth:            int((linkCaps >> 4) & 0x3f),
+		ASPMSupport:             aspmNames[(linkCaps>>10)&0x3],
+		PortNumber:              uint8(linkCaps >> 24),
+		ASPMControl:             aspmNames[linkControl&0x3],
+		CurrentLinkSpeed:        LinkSpeed(linkStatus & 0xf),
+		CurrentLinkWidth:        int((linkStatus >> 4) & 0x3f),
+		LinkTraining:            linkStatus&(1<<11) != 0,
+		DataLinkLayerLinkActive: linkStatus&(1<<13) != 0,
+	}
+	if e.SlotImplemented && r.has(offset+0x14, 4) {
+		slot := uint16(r.u32(offset+0x14) >> 19)
+		e.PhysicalSlot = &slot
+	}
+	// Link Capabilities 2 only exists in version 2 of the capability.
+	if e.Version >= 2 && r.has(offset+0x2c, 4) {
+		vector := r.u32(offset + 0x2c)
+		for i := 1; i <= 7; i++ {
+			if vector&(1<<i) != 0 {
+				e.SupportedLinkSpeeds = append(e.SupportedLinkSpeeds, LinkSpeed(i))
+			}
+		}
+	}
+	return e
+}
@@ -0,0 +1,358 @@
+package pcie
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	configHeaderSize         = 0x40
+	configExtendedOffset     = 0x100
+	maxCapabilities          = 48
+	statusCapabilitiesList   = 1 << 4
+	headerTypeMask           = 0x7f
+	headerTypeMultiFunction  = 0x80
+	HeaderTypeNormal         = 0
+	HeaderTypeBridge         = 1
+	HeaderTypeCardBus        = 2
+	capabilityPointerNormal  = 0x34
+	capabilityPointerCardBus = 0x14
+)
+
+var ErrConfigTooShort = errors.New("config space is shorter than the standard header")
+
+// Register16 is a 16-bit register displayed in hex.
+type Register16 uint16
+
+func (r Register16) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("0x%04x", uint16(r))), nil
+}
+
+func (r *Register16) UnmarshalText(b []byte) error {
+	v, err := parseHex(b, 16)
+	*r = Register16(v)
+	return err
+}
+
+// Address is a bus address or BAR value displayed in hex.
+type Address uint64
+
+func (a Address) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("0x%x", uint64(a))), nil
+}
+
+func (a *Address) UnmarshalText(b []byte) error {
+	v, err := parseHex(b, 64)
+	*a = Address(v)
+	return err
+}
+
+// Offset is a location in config space displayed in hex, the way lspci
+// shows capability offsets.
+type Offset uint16
+
+func (o Offset) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("0x%03x", uint16(o))), nil
+}
+
+func (o *Offset) UnmarshalText(b []byte) error {
+	v, err := parseHex(b, 16)
+	*o = Offset(v)
+	return err
+}
+
+func parseHex(b []byte, bitSize int) (uint64, error) {
+	v, err := strconv.ParseUint(strings.TrimPrefix(string(b), "0x"), 16, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("parsing hex value %q: %w", string(b), err)
+	}
+	return v, nil
+}
+
+// Config is the decoded configuration space of a function.
+type Config struct {
+	Header               Header               `json:"header" yaml:"header"`
+	Capabilities         []Capability         `json:"capabilities,omitempty" yaml:"capabilities,omitempty"`
+	ExtendedCapabilities []ExtendedCapability `json:"extended_capabilities,omitempty" yaml:"extended_capabilities,omitempty"`
+	// Truncated is set when the capability lists point past the end of the
+	// data. Unprivileged reads of sysfs config files only return the first
+	// 64 bytes, so reading the capabilities usually requires root.
+	Truncated bool `json:"truncated,omitempty" yaml:"truncated,omitempty"`
+}
+
+// Header is the part of the standard header shared by all header types.
+type Header struct {
+	VendorID      ID           `json:"vendor_id" yaml:"vendor_id"`
+	DeviceID      ID           `json:"device_id" yaml:"device_id"`
+	Command       Register16   `json:"command" yaml:"command"`
+	Status        Register16   `json:"status" yaml:"status"`
+	Revision      Revision     `json:"revision" yaml:"revision"`
+	ClassCode     ClassCode    `json:"class_code" yaml:"class_code"`
+	CacheLineSize uint8        `json:"cache_line_size" yaml:"cache_line_size"`
+	LatencyTimer  uint8        `json:"latency_timer" yaml:"latency_timer"`
+	HeaderType    uint8        `json:"header_type" yaml:"header_type"`
+	MultiFunction bool         `json:"multi_function" yaml:"multi_function"`
+	BIST          uint8        `json:"bist" yaml:"bist"`
+	Type0         *Type0Header `json:"type0,omitempty" yaml:"type0,omitempty"`
+	Type1         *Type1Header `json:"type1,omitempty" yaml:"type1,omitempty"`
+}
+
+// Type0Header is the remainder of the header of an endpoint.
+type Type0Header struct {
+	BARs                []Address `json:"bars" yaml:"bars"`
+	CardbusCISPointer   uint32    `json:"cardbus_cis_pointer" yaml:"cardbus_cis_pointer"`
+	SubsystemVendorID   ID        `json:"subsystem_vendor_id" yaml:"subsystem_vendor_id"`
+	SubsystemID         ID        `json:"subsystem_id" yaml:"subsystem_id"`
+	ExpansionROM        Address   `json:"expansion_rom" yaml:"expansion_rom"`
+	CapabilitiesPointer uint8     `json:"capabilities_pointer" yaml:"capabilities_pointer"`
+	InterruptLine       uint8     `json:"interrupt_line" yaml:"interrupt_line"`
+	InterruptPin        uint8     `json:"interrupt_pin" yaml:"interrupt_pin"`
+	MinGrant            uint8     `json:"min_grant" yaml:"min_grant"`
+	MaxLatency          uint8     `json:"max_latency" yaml:"max_latency"`
+}
+
+// Type1Header is the remainder of the header of a PCI-to-PCI bridge.
+type Type1Header struct {
+	BARs                  []Address  `json:"bars" yaml:"bars"`
+	PrimaryBus            uint8      `json:"primary_bus" yaml:"primary_bus"`
+	SecondaryBus          uint8      `json:"secondary_bus" yaml:"secondary_bus"`
+	SubordinateBus        uint8      `json:"subordinate_bus" yaml:"subordinate_bus"`
+	SecondaryLatencyTimer uint8      `json:"secondary_latency_timer" yaml:"secondary_latency_timer"`
+	IOBase                Address    `json:"io_base" yaml:"io_base"`
+	IOLimit               Address    `json:"io_limit" yaml:"io_limit"`
+	SecondaryStatus       Register16 `json:"secondary_status" yaml:"secondary_status"`
+	MemoryBase            Address    `json:"memory_base" yaml:"memory_base"`
+	MemoryLimit           Address    `json:"memory_limit" yaml:"memory_limit"`
+	PrefetchableBase      Address    `json:"prefetchable_base" yaml:"prefetchable_base"`
+	PrefetchableLimit     Address    `json:"prefetchable_limit" yaml:"prefetchable_limit"`
+	CapabilitiesPointer   uint8      `json:"capabilities_pointer" yaml:"capabilities_pointer"`
+	ExpansionROM          Address    `json:"expansion_rom" yaml:"expansion_rom"`
+	InterruptLine         uint8      `json:"interrupt_line" yaml:"interrupt_line"`
+	InterruptPin          uint8      `json:"interrupt_pin" yaml:"interrupt_pin"`
+	BridgeControl         Register16 `json:"bridge_control" yaml:"bridge_control"`
+}
+
+// configReader reads little-endian registers out of a config space dump.
+type configReader []byte
+
+func (r configReader) has(offset int, size int) bool {
+	return offset >= 0 && offset+size <= len(r)
+}
+
+func (r configReader) u8(offset int) uint8 {
+	return r[offset]
+}
+
+func (r configReader) u16(offset int) uint16 {
+	return binary.LittleEndian.Uint16(r[offset:])
+}
+
+func (r configReader) u32(offset int) uint32 {
+	return binary.LittleEndian.Uint32(r[offset:])
+}
+
+func (r configReader) u64(offset int) uint64 {
+	return binary.LittleEndian.Uint64(r[offset:])
+}
+
+// ParseConfig decodes a configuration space dump, such as the contents of
+// /sys/bus/pci/devices/<address>/config. The dump must contain at least the
+// 64-byte standard header. Capabilities that lie beyond the end of the dump
+// are skipped and Truncated is set.
+func ParseConfig(b []byte) (*Config, error) {
+	if len(b) < configHeaderSize {
+		return nil, fmt.Errorf("%w: got %d bytes", ErrConfigTooShort, len(b))
+	}
+	r := configReader(b)
+	c := &Config{}
+	h := &c.Header
+	h.VendorID = ID(r.u16(0x00))
+	h.DeviceID = ID(r.u16(0x02))
+	h.Command = Register16(r.u16(0x04))
+	h.Status = Register16(r.u16(0x06))
+	h.Revision = Revision(r.u8(0x08))
+	h.ClassCode = ClassCode(r.u32(0x08) >> 8)
+	h.CacheLineSize = r.u8(0x0c)
+	h.LatencyTimer = r.u8(0x0d)
+	h.HeaderType = r.u8(0x0e) & headerTypeMask
+	h.MultiFunction = r.u8(0x0e)&headerTypeMultiFunction != 0
+	h.BIST = r.u8(0x0f)
+
+	capPointer := capabilityPointerNormal
+	switch h.HeaderType {
+	case HeaderTypeNormal:
+		h.Type0 = parseType0Header(r)
+	case HeaderTypeBridge:
+		h.Type1 = parseType1Header(r)
+	case HeaderTypeCardBus:
+		capPointer = capabilityPointerCardBus
+	}
+
+	if uint16(h.Status)&statusCapabilitiesList != 0 {
+		c.Capabilities, c.Truncated = parseCapabilities(r, int(r.u8(capPointer)))
+	}
+
+	if r.has(configExtendedOffset, 4) {
+		c.ExtendedCapabilities = parseExtendedCapabilities(r)
+	} else if c.Express() != nil {
+		// Every PCI Express function has extended configuration space, so
+		// if we didn't get it the dump was cut short.
+		c.Truncated = true
+	}
+	return c, nil
+}
+
+func parseBARs(r configReader, count int) []Address {
+	bars := []Address{}
+	for i := 0; i < count; i++ {
+		offset := 0x10 + 4*i
+		bar := uint64(r.u32(offset))
+		// 64-bit memory BARs consume the next register as the upper half.
+		if bar&0x1 == 0 && bar&0x6 == 0x4 && i+1 < count {
+			bar |= uint64(r.u32(offset+4)) << 32
+			i++
+		}
+		bars = append(bars, Address(bar))
+	}
+	return bars
+}
+
+func parseType0Header(r configReader) *Type0Header {
+	return &Type0Header{
+		BARs:                parseBARs(r, 6),
+		CardbusCISPointer:   r.u32(0x28),
+		SubsystemVendorID:   ID(r.u16(0x2c)),
+		SubsystemID:         ID(r.u16(0x2e)),
+		ExpansionROM:        Address(r.u32(0x30)),
+		CapabilitiesPointer: r.u8(0x34),
+		InterruptLine:       r.u8(0x3c),
+		InterruptPin:        r.u8(0x3d),
+		MinGrant:            r.u8(0x3e),
+		MaxLatency:          r.u8(0x3f),
+	}
+}
+
+func parseType1Header(r configReader) *Type1Header {
+	h := &Type1Header{
+		BARs:                  parseBARs(r, 2),
+		PrimaryBus:            r.u8(0x18),
+		SecondaryBus:          r.u8(0x19),
+		SubordinateBus:        r.u8(0x1a),
+		SecondaryLatencyTimer: r.u8(0x1b),
+		SecondaryStatus:       Register16(r.u16(0x1e)),
+		CapabilitiesPointer:   r.u8(0x34),
+		ExpansionROM:          Address(r.u32(0x38)),
+		InterruptLine:         r.u8(0x3c),
+		InterruptPin:          r.u8(0x3d),
+		BridgeControl:         Register16(r.u16(0x3e)),
+	}
+
+	ioBase := uint32(r.u8(0x1c)&0xf0) << 8
+	ioLimit := uint32(r.u8(0x1d)&0xf0)<<8 | 0xfff
+	if r.u8(0x1c)&0x0f == 0x01 {
+		ioBase |= uint32(r.u16(0x30)) << 16
+		ioLimit |= uint32(r.u16(0x32)) << 16
+	}
+	h.IOBase = Address(ioBase)
+	h.IOLimit = Address(ioLimit)
+
+	h.MemoryBase = Address(uint32(r.u16(0x20)&0xfff0) << 16)
+	h.MemoryLimit = Address(uint32(r.u16(0x22)&0xfff0)<<16 | 0xfffff)
+
+	prefBase := uint64(r.u16(0x24)&0xfff0) << 16
+	prefLimit := uint64(r.u16(0x26)&0xfff0)<<16 | 0xfffff
+	if r.u16(0x24)&0x0f == 0x01 {
+		prefBase |= uint64(r.u32(0x28)) << 32
+		prefLimit |= uint64(r.u32(0x2c)) << 32
+	}
+	h.PrefetchableBase = Address(prefBase)
+	h.PrefetchableLimit = Address(prefLimit)
+	return h
+}
+
+func parseCapabilities(r configReader, pointer int) ([]Capability, bool) {
+	caps := []Capability{}
+	seen := map[int]bool{}
+	for pointer != 0 && len(caps) < maxCapabilities {
+		// The bottom two bits of capability pointers are reserved.
+		pointer &^= 0x3
+		if pointer < configHeaderSize || seen[pointer] {
+			break
+		}
+		if !r.has(pointer, 2) {
+			return caps, true
+		}
+		seen[pointer] = true
+		caps = append(caps, parseCapability(r, pointer))
+		pointer = int(r.u8(pointer + 1))
+	}
+	return caps, false
+}
+
+func parseExtendedCapabilities(r configReader) []ExtendedCapability {
+	caps := []ExtendedCapability{}
+	seen := map[int]bool{}
+	pointer := configExtendedOffset
+	for pointer != 0 {
+		if pointer < configExtendedOffset || seen[pointer] || !r.has(pointer, 4) {
+			break
+		}
+		seen[pointer] = true
+		header := r.u32(pointer)
+		// An all-zero or all-ones header at 0x100 means there are no
+		// extended capabilities.
+		if header == 0 || header == 0xffffffff {
+			break
+		}
+		caps = append(caps, parseExtendedCapability(r, pointer))
+		pointer = int(header>>20) &^ 0x3
+	}
+	return caps
+}
+
+// ACS returns the Access Control Services capability, or nil if the device
+// doesn't have one.
+func (c *Config) ACS() *ACSCapability {
+	for _, capability := range c.ExtendedCapabilities {
+		if capability.ACS != nil {
+			return capability.ACS
+		}
+	}
+	return nil
+}
+
+// AER returns the Advanced Error Reporting capability, or nil if the
+// function doesn't have one.
+func (c *Config) AER() *AERCapability {
+	for _, capability := range c.ExtendedCapabilities {
+		if capability.AER != nil {
+			return capability.AER
+		}
+	}
+	return nil
+}
+
+// SRIOV returns the Single Root I/O Virtualization capability, or nil if
+// the function isn't a physical function.
+func (c *Config) SRIOV() *SRIOVCapability {
+	for _, capability := range c.ExtendedCapabilities {
+		if capability.SRIOV != nil {
+			return capability.SRIOV
+		}
+	}
+	return nil
+}
+
+// Express returns the PCI Express capability, or nil if the function
+// doesn't have one.
+func (c *Config) Express() *ExpressCapability {
+	for _, capability := range c.Capabilities {
+		if capability.Express != nil {
+			return capability.Express
+		}
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package pcie
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// endpointConfig is the first 512 bytes of config space modeled on a
+// ConnectX-6 Dx physical function, in the format of lspci -xxxx. Its
+// capabilities are PCI Express (0x60), MSI-X (0x9c) and Power Management
+// (0x40), followed by AER (0x100), SR-IOV (0x150) and Device Serial Number
+// (0x190).
+const endpointConfig = `
+00: b3 15 1d 10 06 04 10 00 00 00 00 02 00 00 80 00
+10: 0c 00 00 00 e0 00 00 00 00 00 00 00 00 00 00 00
+20: 00 00 00 00 00 00 00 00 00 00 00 00 b3 15 16 00
+30: 00 00 00 00 60 00 00 00 00 00 00 00 ff 01 00 00
+40: 01 00 03 48 00 00 00 00 00 00 00 00 00 00 00 00
+50: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+60: 10 9c 02 00 02 00 00 00 20 20 00 00 04 0d 00 00
+70: 02 00 83 20 00 00 00 00 00 00 00 00 00 00 00 00
+80: 00 00 00 00 00 00 00 00 00 00 00 00 1e 00 00 00
+90: 00 00 00 00 00 00 00 00 00 00 00 00 11 40 3f 80
+a0: 00 20 00 00 00 30 00 00 00 00 00 00 00 00 00 00
+b0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+c0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+d0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+e0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+f0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+100: 01 00 02 15 00 00 00 00 00 00 00 00 30 20 46 00
+110: 41 00 00 00 00 20 00 00 00 00 00 00 00 00 00 00
+120: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+130: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+140: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+150: 10 00 01 19 00 00 00 00 01 00 00 00 08 00 08 00
+160: 04 00 00 00 01 00 01 00 00 00 1e 10 00 00 00 00
+170: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+180: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+190: 03 00 01 00 b8 e2 00 03 03 9f 59 b8 00 00 00 00
+1a0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+1b0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+1c0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+1d0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+1e0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+1f0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+`
+
+// rootPortConfig is the first 512 bytes of config space modeled on a root
+// port with MSI (0x50) and PCI Express (0x58), followed by ACS (0x100) and AER
+// (0x148).
+const rootPortConfig = `
+00: 22 10 83 14 07 04 10 00 00 00 04 06 00 00 81 00
+10: 00 00 00 00 00 00 00 00 00 41 41 00 f1 01 00 00
+20: 00 f6 f0 f6 01 e0 f1 e0 00 01 00 00 00 01 00 00
+30: 00 00 00 00 50 00 00 00 00 00 00 00 00 00 12 00
+40: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+50: 05 58 81 00 00 00 00 00 10 00 42 01 05 00 00 00
+60: 10 20 00 00 04 09 00 01 00 00 04 21 00 00 28 00
+70: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+80: 00 00 00 00 1e 00 00 00 00 00 00 00 00 00 00 00
+90: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+a0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+b0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+c0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+d0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+e0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+f0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+100: 0d 00 81 14 5f 00 1d 00 00 00 00 00 00 00 00 00
+110: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+120: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+130: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+140: 00 00 00 00 00 00 00 00 01 00 02 00 00 00 10 00
+150: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+160: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+170: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+180: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+190: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+1a0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+1b0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+1c0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+1d0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+1e0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+1f0: 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00
+`
+
+// parseDump decodes the output of lspci -xxxx.
+func parseDump(t *testing.T, dump string) []byte {
+	t.Helper()
+	b := []byte{}
+	for _, line := range strings.Split(strings.TrimSpace(dump), "\n") {
+		offset, data, ok := strings.Cut(line, ": ")
+		if !ok {
+			t.Fatalf("malformed dump line %q", line)
+		}
+		if o, err := strconv.ParseUint(offset, 16, 16); err != nil || int(o) != len(b) {
+			t.Fatalf("dump line %q is not at offset %d", line, len(b))
+		}
+		bytes, err := hex.DecodeString(strings.ReplaceAll(data, " ", ""))
+		if err != nil {
+			t.Fatalf("decoding dump line %q: %v", line, err)
+		}
+		b = append(b, bytes...)
+	}
+	return b
+}
+
+func capabilityIDs(c *Config) []uint8 {
+	ids := []uint8{}
+	for _, capability := range c.Capabilities {
+		ids = append(ids, capability.ID)
+	}
+	return ids
+}
+
+func extendedCapabilityIDs(c *Config) []uint16 {
+	ids := []uint16{}
+	for _, capability := range c.ExtendedCapabilities {
+		ids = append(ids, capability.ID)
+	}
+	return ids
+}
+
+func TestParseConfigEndpoint(t *testing.T) {
+	c, err := ParseConfig(parseDump(t, endpointConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := c.Header
+	if h.VendorID != 0x15b3 || h.DeviceID != 0x101d || h.ClassCode != 0x020000 || h.HeaderType != HeaderTypeNormal || !h.MultiFunction {
+		t.Errorf("header = %+v", h)
+	}
+	if h.Type0 == nil || h.Type1 != nil {
+		t.Fatal("expected a type 0 header only")
+	}
+	if want := []Address{0xe0_0000_000c, 0, 0, 0, 0}; !reflect.DeepEqual(h.Type0.BARs, want) {
+		t.Errorf("BARs = %x, want %x", h.Type0.BARs, want)
+	}
+	if h.Type0.SubsystemVendorID != 0x15b3 || h.Type0.SubsystemID != 0x0016 {
+		t.Errorf("subsystem = %s:%s, want 0x15b3:0x0016", h.Type0.SubsystemVendorID, h.Type0.SubsystemID)
+	}
+	if c.Truncated {
+		t.Error("Truncated is set")
+	}
+	if got, want := capabilityIDs(c), []uint8{0x10, 0x11, 0x01}; !reflect.DeepEqual(got, want) {
+		t.Errorf("capabilities = %x, want %x", got, want)
+	}
+	if got, want := extendedCapabilityIDs(c), []uint16{0x0001, 0x0010, 0x0003}; !reflect.DeepEqual(got, want) {
+		t.Errorf("extended capabilities = %x, want %x", got, want)
+	}
+
+	e := c.Express()
+	if e == nil {
+		t.Fatal("no PCI Express capability")
+	}
+	wantExpress := ExpressCapability{
+		Version:                 2,
+		PortType:                PortTypeEndpoint,
+		MaxPayloadSupported:     512,
+		MaxPayload:              256,
+		MaxReadRequest:          512,
+		MaxLinkSpeed:            4,
+		MaxLinkWidth:            16,
+		SupportedLinkSpeeds:     []LinkSpeed{1, 2, 3, 4},
+		ASPMSupport:             "L0s L1",
+		ASPMControl:             "L1",
+		CurrentLinkSpeed:        3,
+		CurrentLinkWidth:        8,
+		DataLinkLayerLinkActive: true,
+	}
+	if !reflect.DeepEqual(*e, wantExpress) {
+		t.Errorf("express = %+v, want %+v", *e, wantExpress)
+	}
+	link := NewLinkStatusFromExpress(e)
+	if *link != (LinkStatus{CurrentSpeed: 3, CurrentWidth: 8, MaxSpeed: 4, MaxWidth: 16}) || !link.Downtrained() {
+		t.Errorf("link = %s, want a downtrained Gen3 x8 of Gen4 x16", link)
+	}
+
+	msix := c.Capabilities[1].MSIX
+	if msix == nil || !msix.Enabled || msix.TableSize != 64 || msix.TableOffset != 0x2000 || msix.PBAOffset != 0x3000 {
+		t.Errorf("MSI-X = %+v", msix)
+	}
+	if pm := c.Capabilities[2].PowerManagement; pm == nil || pm.Version != 3 || pm.PMESupport != "D0,D3hot" || pm.PowerState != "D0" {
+		t.Errorf("power management = %+v", pm)
+	}
+
+	wantAER := &AERCapability{
+		UncorrectableStatus: []string{},
+		UncorrectableMask:   []string{},
+		UncorrectableFatal:  []string{"DLP", "SDES", "FCP", "RxOF", "MalfTLP", "UncorrIntErr"},
+		CorrectableStatus:   []string{"RxErr", "BadTLP"},
+		CorrectableMask:     []string{"NonFatalErr"},
+	}
+	if got := c.AER(); !reflect.DeepEqual(got, wantAER) {
+		t.Errorf("AER = %+v, want %+v", got, wantAER)
+	}
+	wantSRIOV := &SRIOVCapability{
+		TotalVFs:      8,
+		InitialVFs:    8,
+		NumVFs:        4,
+		VFEnable:      true,
+		FirstVFOffset: 1,
+		VFStride:      1,
+		VFDeviceID:    0x101e,
+	}
+	if got := c.SRIOV(); !reflect.DeepEqual(got, wantSRIOV) {
+		t.Errorf("SR-IOV = %+v, want %+v", got, wantSRIOV)
+	}
+	if got := c.ExtendedCapabilities[2].DeviceSerialNumber; got != "b8-59-9f-03-03-00-e2-b8" {
+		t.Errorf("serial number = %s", got)
+	}
+	if c.ACS() != nil {
+		t.Error("endpoint has an ACS capability")
+	}
+}
+
+func TestParseConfigRootPort(t *testing.T) {
+	c, err := ParseConfig(parseDump(t, rootPortConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := c.Header
+	if h.HeaderType != HeaderTypeBridge || h.Type1 == nil || h.Type0 != nil {
+		t.Fatalf("header = %+v, want a type 1 header", h)
+	}
+	b := h.Type1
+	if b.PrimaryBus != 0x00 || b.SecondaryBus != 0x41 || b.SubordinateBus != 0x41 {
+		t.Errorf("buses = %02x/%02x/%02x, want 00/41/41", b.PrimaryBus, b.SecondaryBus, b.SubordinateBus)
+	}
+	if b.MemoryBase != 0xf6000000 || b.MemoryLimit != 0xf6ffffff {
+		t.Errorf("memory window = %x-%x", b.MemoryBase, b.MemoryLimit)
+	}
+	if b.PrefetchableBase != 0x100_e0000000 || b.PrefetchableLimit != 0x100_e0ffffff {
+		t.Errorf("prefetchable window = %x-%x", b.PrefetchableBase, b.PrefetchableLimit)
+	}
+	if got, want := capabilityIDs(c), []uint8{0x05, 0x10}; !reflect.DeepEqual(got, want) {
+		t.Errorf("capabilities = %x, want %x", got, want)
+	}
+	if got, want := extendedCapabilityIDs(c), []uint16{0x000d, 0x0001}; !reflect.DeepEqual(got, want) {
+		t.Errorf("extended capabilities = %x, want %x", got, want)
+	}
+
+	e := c.Express()
+	if e == nil || e.PortType != PortTypeRootPort || e.PortNumber != 1 {
+		t.Fatalf("express = %+v, want root port 1", e)
+	}
+	if e.PhysicalSlot == nil || *e.PhysicalSlot != 5 {
+		t.Errorf("physical slot = %v, want 5", e.PhysicalSlot)
+	}
+	if e.CurrentLinkSpeed != 4 || e.CurrentLinkWidth != 16 || e.MaxLinkSpeed != 4 || e.MaxLinkWidth != 16 {
+		t.Errorf("link = Gen%d x%d of Gen%d x%d, want Gen4 x16 of Gen4 x16",
+			e.CurrentLinkSpeed, e.CurrentLinkWidth, e.MaxLinkSpeed, e.MaxLinkWidth)
+	}
+
+	wantACS := &ACSCapability{
+		Capabilities: ACSFlags{
+			SourceValidation:    true,
+			TranslationBlocking: true,
+			RequestRedirect:     true,
+			CompletionRedirect:  true,
+			UpstreamForwarding:  true,
+			DirectTranslated:    true,
+		},
+		Control: ACSFlags{
+			SourceValidation:   true,
+			RequestRedirect:    true,
+			CompletionRedirect: true,
+			UpstreamForwarding: true,
+		},
+	}
+	if got := c.ACS(); !reflect.DeepEqual(got, wantACS) {
+		t.Errorf("ACS = %+v, want %+v", got, wantACS)
+	}
+	if got := c.AER(); got == nil || !reflect.DeepEqual(got.UncorrectableStatus, []string{"UnsupReq"}) {
+		t.Errorf("AER = %+v, want UnsupReq in the uncorrectable status", got)
+	}
+}
+
+func TestParseConfigTruncated(t *testing.T) {
+	full := parseDump(t, endpointConfig)
+	for _, tt := range []struct {
+		name         string
+		size         int
+		capabilities []uint8
+		extended     []uint16
+		truncated    bool
+	}{
+		// Unprivileged reads of the config file stop at the header.
+		{name: "header only", size: 64, capabilities: []uint8{}, extended: []uint16{}, truncated: true},
+		// Conventional config space, without the extended capabilities.
+		{name: "conventional", size: 256, capabilities: []uint8{0x10, 0x11, 0x01}, extended: []uint16{}, truncated: true},
+		// Cut in the middle of the SR-IOV capability, which is skipped.
+		{name: "extended", size: 0x160, capabilities: []uint8{0x10, 0x11, 0x01}, extended: []uint16{0x0001, 0x0010}, truncated: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseConfig(full[:tt.size])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := capabilityIDs(c); !reflect.DeepEqual(got, tt.capabilities) {
+				t.Errorf("capabilities = %x, want %x", got, tt.capabilities)
+			}
+			if got := extendedCapabilityIDs(c); !reflect.DeepEqual(got, tt.extended) {
+				t.Errorf("extended capabilities = %x, want %x", got, tt.extended)
+			}
+			if c.Truncated != tt.truncated {
+				t.Errorf("Truncated = %v, want %v", c.Truncated, tt.truncated)
+			}
+			if c.SRIOV() != nil {
+				t.Error("SR-IOV capability decoded from a truncated dump")
+			}
+		})
+	}
+
+	if _, err := ParseConfig(full[:63]); !errors.Is(err, ErrConfigTooShort) {
+		t.Errorf("ParseConfig of 63 bytes returned %v, want ErrConfigTooShort", err)
+	}
+}
+
+func TestParseConfigLoops(t *testing.T) {
+	b := parseDump(t, endpointConfig)
+	// Point Power Management, the last legacy capability, back at PCI
+	// Express, and SR-IOV back at AER.
+	b[0x41] = 0x60
+	b[0x152] = 0x00
+	b[0x153] = 0x10
+	c, err := ParseConfig(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := capabilityIDs(c), []uint8{0x10, 0x11, 0x01}; !reflect.DeepEqual(got, want) {
+		t.Errorf("capabilities = %x, want %x", got, want)
+	}
+	if got, want := extendedCapabilityIDs(c), []uint16{0x0001, 0x0010}; !reflect.DeepEqual(got, want) {
+		t.Errorf("extended capabilities = %x, want %x", got, want)
+	}
+}
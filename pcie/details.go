@@ -10,8 +10,40 @@ import (
 )
 
 type AdditionalDetails struct {
-	NumaNode     *int
-	LocalCPUList *string
+	NumaNode          *int           `json:"numa_node,omitempty" yaml:"numa_node,omitempty"`
+	LocalCPUList      *string        `json:"local_cpulist,omitempty" yaml:"local_cpulist,omitempty"`
+	VendorID          *ID            `json:"vendor_id,omitempty" yaml:"vendor_id,omitempty"`
+	DeviceID          *ID            `json:"device_id,omitempty" yaml:"device_id,omitempty"`
+	SubsystemVendorID *ID            `json:"subsystem_vendor_id,omitempty" yaml:"subsystem_vendor_id,omitempty"`
+	SubsystemDeviceID *ID            `json:"subsystem_device_id,omitempty" yaml:"subsystem_device_id,omitempty"`
+	ClassCode         *ClassCode     `json:"class_code,omitempty" yaml:"class_code,omitempty"`
+	Revision          *Revision      `json:"revision,omitempty" yaml:"revision,omitempty"`
+	Config            *Config        `json:"config,omitempty" yaml:"config,omitempty"`
+	Link              *LinkStatus    `json:"link,omitempty" yaml:"link,omitempty"`
+	IOMMUGroup        *int           `json:"iommu_group,omitempty" yaml:"iommu_group,omitempty"`
+	SRIOV             *SRIOV         `json:"sriov,omitempty" yaml:"sriov,omitempty"`
+	DriverBinding     *DriverBinding `json:"driver_binding,omitempty" yaml:"driver_binding,omitempty"`
+	AER               *AERCounters   `json:"aer,omitempty" yaml:"aer,omitempty"`
+	// PhysFn is the address of the physical function of a virtual
+	// function.
+	PhysFn *string `json:"physfn,omitempty" yaml:"physfn,omitempty"`
+}
+
+// readSysfsHex reads a sysfs attribute formatted as a hex number, such as
+// vendor or class. A nil value is returned if the attribute does not exist.
+func readSysfsHex(sysfsPath *pathlib.Path, name string, bitSize int) (*uint64, error) {
+	b, err := sysfsPath.Join(name).ReadFile()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	v, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(string(b)), "0x"), 16, bitSize)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", name, err)
+	}
+	return &v, nil
 }
 
 func NewAdditionalDetailsFromSysfs(sysfsPath *pathlib.Path) (AdditionalDetails, error) {
@@ -37,50 +69,166 @@ func NewAdditionalDetailsFromSysfs(sysfsPath *pathlib.Path) (AdditionalDetails,
 			return d, fmt.Errorf("reading local_cpulist: %w", err)
 		}
 	} else {
-		asStr := string(cpuListBytes)
+		asStr := strings.TrimSpace(string(cpuListBytes))
 		d.LocalCPUList = &asStr
 	}
 
+	for _, id := range []struct {
+		name string
+		dst  **ID
+	}{
+		{"vendor", &d.VendorID},
+		{"device", &d.DeviceID},
+		{"subsystem_vendor", &d.SubsystemVendorID},
+		{"subsystem_device", &d.SubsystemDeviceID},
+	} {
+		v, err := readSysfsHex(sysfsPath, id.name, 16)
+		if err != nil {
+			return d, err
+		}
+		if v != nil {
+			asID := ID(*v)
+			*id.dst = &asID
+		}
+	}
+
+	class, err := readSysfsHex(sysfsPath, "class", 24)
+	if err != nil {
+		return d, err
+	}
+	if class != nil {
+		classCode := ClassCode(*class)
+		d.ClassCode = &classCode
+	}
+
+	revision, err := readSysfsHex(sysfsPath, "revision", 8)
+	if err != nil {
+		return d, err
+	}
+	if revision != nil {
+		rev := Revision(*revision)
+		d.Revision = &rev
+	}
+
+	configBytes, err := sysfsPath.Join("config").ReadFile()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return d, fmt.Errorf("reading config: %w", err)
+		}
+	} else {
+		config, err := ParseConfig(configBytes)
+		if err != nil {
+			return d, fmt.Errorf("parsing config: %w", err)
+		}
+		d.Config = config
+	}
+
+	link, err := NewLinkStatusFromSysfs(sysfsPath)
+	if err != nil {
+		return d, err
+	}
+	// Older kernels don't expose the link attributes, but the same
+	// information is in the PCI Express capability if we could read it.
+	if link == nil && d.Config != nil {
+		if express := d.Config.Express(); express != nil {
+			link = NewLinkStatusFromExpress(express)
+		}
+	}
+	d.Link = link
+
+	if d.IOMMUGroup, err = readIOMMUGroup(sysfsPath); err != nil {
+		return d, err
+	}
+	if d.SRIOV, err = readSRIOV(sysfsPath, d.Config); err != nil {
+		return d, err
+	}
+	if d.PhysFn, err = readPhysFn(sysfsPath); err != nil {
+		return d, err
+	}
+	if d.DriverBinding, err = readDriverBinding(sysfsPath); err != nil {
+		return d, err
+	}
+	if d.AER, err = readAERCounters(sysfsPath); err != nil {
+		return d, err
+	}
+
 	return d, nil
 }
 
+// Details describes a single device. The field names match the keys of
+// `lshw -json` so that its output can be unmarshalled directly.
 type Details struct {
-	AdditionalDetails // Details not provided by lshw that we need to scrape ourselves
-	Id                string
-	Class             string
-	Claimed           bool
-	Handle            string
-	Description       string
-	Product           string
-	Vendor            string
-	Physid            string
-	Businfo           string
-	Version           string
-	Width             int
-	Clock             int
-	Serial            string
-	Slot              string
-	Units             string
-	Size              int
-	Configuration     map[string]any
-	Capabilities      map[string]any
+	Id                string           `json:"id" yaml:"id"`
+	Class             string           `json:"class" yaml:"class"`
+	Claimed           bool             `json:"claimed,omitempty" yaml:"claimed,omitempty"`
+	Handle            string           `json:"handle,omitempty" yaml:"handle,omitempty"`
+	Description       string           `json:"description,omitempty" yaml:"description,omitempty"`
+	Product           string           `json:"product,omitempty" yaml:"product,omitempty"`
+	Vendor            string           `json:"vendor,omitempty" yaml:"vendor,omitempty"`
+	Physid            string           `json:"physid,omitempty" yaml:"physid,omitempty"`
+	Businfo           string           `json:"businfo,omitempty" yaml:"businfo,omitempty"`
+	Version           string           `json:"version,omitempty" yaml:"version,omitempty"`
+	Width             int              `json:"width,omitempty" yaml:"width,omitempty"`
+	Clock             int              `json:"clock,omitempty" yaml:"clock,omitempty"`
+	Serial            string           `json:"serial,omitempty" yaml:"serial,omitempty"`
+	Slot              string           `json:"slot,omitempty" yaml:"slot,omitempty"`
+	Units             string           `json:"units,omitempty" yaml:"units,omitempty"`
+	Size              int              `json:"size,omitempty" yaml:"size,omitempty"`
+	Configuration     map[string]any   `json:"configuration,omitempty" yaml:"configuration,omitempty"`
+	Capabilities      map[string]any   `json:"capabilities,omitempty" yaml:"capabilities,omitempty"`
+	AdditionalDetails `yaml:",inline"` // Details not provided by lshw that we need to scrape ourselves
 }
 
-func (d *Details) GetAdditionalDetails() error {
+// Address returns the PCI address (domain:bus:device.function) portion of
+// Businfo, or an empty string if Businfo is not a PCI address.
+func (d *Details) Address() string {
 	addressSplit := strings.Split(d.Businfo, "@")
-	if len(addressSplit) != 2 {
+	if len(addressSplit) != 2 || addressSplit[0] != "pci" {
+		return ""
+	}
+	return addressSplit[1]
+}
+
+// NormalizeAddress accepts a PCI address in the forms users commonly type,
+// such as "c1:00.0", "0000:C1:00.0" or "pci@0000:c1:00.0", and returns it in
+// the domain:bus:device.function form used by sysfs.
+func NormalizeAddress(address string) string {
+	address = strings.ToLower(strings.TrimPrefix(address, "pci@"))
+	if strings.Count(address, ":") == 1 {
+		address = "0000:" + address
+	}
+	return address
+}
+
+func (d *Details) GetAdditionalDetails() error {
+	return d.GetAdditionalDetailsFromSysfs(DefaultSysfs)
+}
+
+func (d *Details) GetAdditionalDetailsFromSysfs(sysfs *Sysfs) error {
+	address := d.Address()
+	if address == "" {
 		return nil
 	}
-	address := addressSplit[1]
-	sysfsPath := pathlib.NewPath("/sys/bus/pci/devices/" + address)
-	details, err := NewAdditionalDetailsFromSysfs(sysfsPath)
+	details, err := NewAdditionalDetailsFromSysfs(sysfs.DevicePath(address))
 	if err != nil {
 		return err
 	}
+	sysfs.addCandidateModules(&details)
 	d.AdditionalDetails = details
 	return nil
 }
 
+// Driver returns the name of the driver bound to the device, if known.
+// lshw doesn't always report the driver, such as for vfio-pci, so the
+// driver link read from sysfs is used when it doesn't.
+func (d *Details) Driver() string {
+	driver, _ := d.Configuration["driver"].(string)
+	if driver == "" && d.DriverBinding != nil {
+		driver = d.DriverBinding.Driver
+	}
+	return driver
+}
+
 func (d Details) String() string {
 	var s string
 	s += d.Class + " | "
@@ -0,0 +1,149 @@
+package pcie
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/chigopher/pathlib"
+)
+
+// DriverBinding describes the kernel driver bound to a device and the ones
+// that could be.
+type DriverBinding struct {
+	// Driver is the driver the device is bound to, if any.
+	Driver string `json:"driver,omitempty" yaml:"driver,omitempty"`
+	// Override is the only driver allowed to bind to the device, as set
+	// through driver_override, typically to vfio-pci.
+	Override string `json:"driver_override,omitempty" yaml:"driver_override,omitempty"`
+	// Module is the kernel module providing Driver. It is empty if the
+	// driver is built into the kernel.
+	Module   string `json:"module,omitempty" yaml:"module,omitempty"`
+	Modalias string `json:"modalias,omitempty" yaml:"modalias,omitempty"`
+	// CandidateModules are the modules whose aliases match Modalias, which
+	// are the ones modprobe would consider for the device.
+	CandidateModules []string `json:"candidate_modules,omitempty" yaml:"candidate_modules,omitempty"`
+}
+
+// readDriverBinding reads the driver and module links and the
+// driver_override and modalias attributes of a device. A nil value is
+// returned if none of them exist.
+func readDriverBinding(sysfsPath *pathlib.Path) (*DriverBinding, error) {
+	b := &DriverBinding{}
+	found := false
+	driver, err := sysfsPath.Join("driver").Readlink()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading driver link: %w", err)
+	}
+	if err == nil {
+		found = true
+		b.Driver = driver.Name()
+		module, err := sysfsPath.Join("driver", "module").Readlink()
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("reading driver module link: %w", err)
+		}
+		if err == nil {
+			b.Module = module.Name()
+		}
+	}
+	for _, attr := range []struct {
+		name string
+		dst  *string
+	}{
+		{"driver_override", &b.Override},
+		{"modalias", &b.Modalias},
+	} {
+		v, err := sysfsPath.Join(attr.name).ReadFile()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("reading %s: %w", attr.name, err)
+		}
+		found = true
+		// driver_override reads as "(null)" when it isn't set.
+		if s := strings.TrimSpace(string(v)); s != "(null)" {
+			*attr.dst = s
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+	return b, nil
+}
+
+// ModuleAliases are the PCI aliases of modules.alias, which map the
+// modalias of a device to the modules that can drive it.
+type ModuleAliases struct {
+	aliases []moduleAlias
+}
+
+type moduleAlias struct {
+	pattern string
+	module  string
+}
+
+// FindModuleAliases loads the modules.alias of the running kernel. It
+// returns nil if there isn't one, such as in containers.
+func FindModuleAliases() (*ModuleAliases, error) {
+	release, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading kernel release: %w", err)
+	}
+	p := pathlib.NewPath("/lib/modules").Join(strings.TrimSpace(string(release)), "modules.alias")
+	aliases, err := LoadModuleAliases(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return aliases, nil
+}
+
+func LoadModuleAliases(file *pathlib.Path) (*ModuleAliases, error) {
+	b, err := file.ReadFile()
+	if err != nil {
+		return nil, err
+	}
+	a := &ModuleAliases{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[0] != "alias" || !strings.HasPrefix(fields[1], "pci:") {
+			continue
+		}
+		a.aliases = append(a.aliases, moduleAlias{pattern: fields[1], module: fields[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scanning %s: %w", file, err)
+	}
+	return a, nil
+}
+
+// Modules returns the modules with an alias matching modalias, in the
+// order they appear in modules.alias.
+func (a *ModuleAliases) Modules(modalias string) []string {
+	if a == nil || modalias == "" {
+		return nil
+	}
+	modules := []string{}
+	seen := map[string]bool{}
+	for _, alias := range a.aliases {
+		if seen[alias.module] {
+			continue
+		}
+		// Aliases are shell wildcards, matched the way modprobe does.
+		if ok, _ := path.Match(alias.pattern, modalias); ok {
+			seen[alias.module] = true
+			modules = append(modules, alias.module)
+		}
+	}
+	return modules
+}
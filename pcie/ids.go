@@ -0,0 +1,297 @@
+package pcie
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chigopher/pathlib"
+)
+
+// ID is a 16-bit PCI vendor or device identifier.
+type ID uint16
+
+func (i ID) String() string {
+	return fmt.Sprintf("0x%04x", uint16(i))
+}
+
+func (i ID) MarshalText() ([]byte, error) {
+	return []byte(i.String()), nil
+}
+
+func (i *ID) UnmarshalText(b []byte) error {
+	v, err := strconv.ParseUint(strings.TrimPrefix(string(b), "0x"), 16, 16)
+	if err != nil {
+		return fmt.Errorf("parsing PCI ID %q: %w", string(b), err)
+	}
+	*i = ID(v)
+	return nil
+}
+
+// ClassCode is the 24-bit base class, subclass and programming interface of
+// a function.
+type ClassCode uint32
+
+func (c ClassCode) Base() uint8 {
+	return uint8(c >> 16)
+}
+
+func (c ClassCode) Sub() uint8 {
+	return uint8(c >> 8)
+}
+
+func (c ClassCode) String() string {
+	return fmt.Sprintf("0x%06x", uint32(c))
+}
+
+func (c ClassCode) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *ClassCode) UnmarshalText(b []byte) error {
+	v, err := strconv.ParseUint(strings.TrimPrefix(string(b), "0x"), 16, 24)
+	if err != nil {
+		return fmt.Errorf("parsing class code %q: %w", string(b), err)
+	}
+	*c = ClassCode(v)
+	return nil
+}
+
+// Revision is the 8-bit revision ID of a function.
+type Revision uint8
+
+func (r Revision) String() string {
+	return fmt.Sprintf("0x%02x", uint8(r))
+}
+
+func (r Revision) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Revision) UnmarshalText(b []byte) error {
+	v, err := strconv.ParseUint(strings.TrimPrefix(string(b), "0x"), 16, 8)
+	if err != nil {
+		return fmt.Errorf("parsing revision %q: %w", string(b), err)
+	}
+	*r = Revision(v)
+	return nil
+}
+
+// lshwClasses maps PCI base classes onto the class names lshw uses, so that
+// devices discovered through sysfs render the same way as lshw devices.
+var lshwClasses = map[uint8]string{
+	0x00: "generic",
+	0x01: "storage",
+	0x02: "network",
+	0x03: "display",
+	0x04: "multimedia",
+	0x05: "memory",
+	0x06: "bridge",
+	0x07: "communication",
+	0x08: "generic",
+	0x09: "input",
+	0x0a: "generic",
+	0x0b: "processor",
+	0x0c: "bus",
+	0x0d: "communication",
+	0x0e: "generic",
+	0x0f: "communication",
+	0x10: "generic",
+	0x11: "generic",
+	0x12: "generic",
+	0x13: "generic",
+}
+
+// LshwClass returns the lshw class name for the base class of c.
+func (c ClassCode) LshwClass() string {
+	if class, ok := lshwClasses[c.Base()]; ok {
+		return class
+	}
+	return "generic"
+}
+
+// subclassNames is used to describe devices when no pci.ids database is
+// available.
+var subclassNames = map[uint16]string{
+	0x0100: "SCSI storage controller",
+	0x0101: "IDE interface",
+	0x0104: "RAID bus controller",
+	0x0106: "SATA controller",
+	0x0107: "Serial Attached SCSI controller",
+	0x0108: "Non-Volatile memory controller",
+	0x0180: "Mass storage controller",
+	0x0200: "Ethernet controller",
+	0x0207: "Infiniband controller",
+	0x0280: "Network controller",
+	0x0300: "VGA compatible controller",
+	0x0302: "3D controller",
+	0x0380: "Display controller",
+	0x0403: "Audio device",
+	0x0500: "RAM memory",
+	0x0600: "Host bridge",
+	0x0601: "ISA bridge",
+	0x0604: "PCI bridge",
+	0x0680: "Bridge",
+	0x0700: "Serial controller",
+	0x0780: "Communication controller",
+	0x0800: "PIC",
+	0x0880: "System peripheral",
+	0x0c03: "USB controller",
+	0x0c05: "SMBus",
+	0x1080: "Encryption controller",
+	0x1200: "Processing accelerators",
+	0x1300: "Non-Essential Instrumentation",
+}
+
+// IDDatabase resolves PCI IDs into human readable names using the pci.ids
+// file shipped by most distributions.
+type IDDatabase struct {
+	vendors    map[ID]string
+	devices    map[ID]map[ID]string
+	subclasses map[uint16]string
+}
+
+// DefaultIDDatabasePaths are the locations searched by FindIDDatabase.
+var DefaultIDDatabasePaths = []string{
+	"/usr/share/hwdata/pci.ids",
+	"/usr/share/misc/pci.ids",
+	"/usr/share/pci.ids",
+}
+
+// FindIDDatabase loads the first pci.ids file found in DefaultIDDatabasePaths.
+// It returns nil if none of them exist.
+func FindIDDatabase() (*IDDatabase, error) {
+	for _, p := range DefaultIDDatabasePaths {
+		db, err := LoadIDDatabase(pathlib.NewPath(p))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		return db, nil
+	}
+	return nil, nil
+}
+
+func LoadIDDatabase(path *pathlib.Path) (*IDDatabase, error) {
+	b, err := path.ReadFile()
+	if err != nil {
+		return nil, err
+	}
+	db := &IDDatabase{
+		vendors:    map[ID]string{},
+		devices:    map[ID]map[ID]string{},
+		subclasses: map[uint16]string{},
+	}
+	var (
+		vendor  ID
+		class   uint8
+		inClass bool
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		depth := len(line) - len(strings.TrimLeft(line, "\t"))
+		line = strings.TrimLeft(line, "\t")
+		switch {
+		case depth == 0 && strings.HasPrefix(line, "C "):
+			id, _, ok := splitIDLine(strings.TrimPrefix(line, "C "))
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseUint(id, 16, 8)
+			if err != nil {
+				continue
+			}
+			class = uint8(v)
+			inClass = true
+		case depth == 0:
+			id, name, ok := splitIDLine(line)
+			if !ok {
+				inClass = false
+				continue
+			}
+			v, err := strconv.ParseUint(id, 16, 16)
+			if err != nil {
+				inClass = false
+				continue
+			}
+			vendor = ID(v)
+			db.vendors[vendor] = name
+			inClass = false
+		case depth == 1 && inClass:
+			id, name, ok := splitIDLine(line)
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseUint(id, 16, 8)
+			if err != nil {
+				continue
+			}
+			db.subclasses[uint16(class)<<8|uint16(v)] = name
+		case depth == 1:
+			id, name, ok := splitIDLine(line)
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseUint(id, 16, 16)
+			if err != nil {
+				continue
+			}
+			if db.devices[vendor] == nil {
+				db.devices[vendor] = map[ID]string{}
+			}
+			db.devices[vendor][ID(v)] = name
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scanning %s: %w", path, err)
+	}
+	return db, nil
+}
+
+func splitIDLine(line string) (id string, name string, ok bool) {
+	id, name, ok = strings.Cut(line, " ")
+	return id, strings.TrimSpace(name), ok
+}
+
+// Vendor returns the name of the vendor, falling back to the hex ID.
+func (db *IDDatabase) Vendor(vendor ID) string {
+	if db != nil {
+		if name, ok := db.vendors[vendor]; ok {
+			return name
+		}
+	}
+	return vendor.String()
+}
+
+// Product returns the name of the device, falling back to the hex ID.
+func (db *IDDatabase) Product(vendor ID, device ID) string {
+	if db != nil {
+		if name, ok := db.devices[vendor][device]; ok {
+			return name
+		}
+	}
+	return device.String()
+}
+
+// Description returns the name of the subclass of c.
+func (db *IDDatabase) Description(c ClassCode) string {
+	key := uint16(c.Base())<<8 | uint16(c.Sub())
+	if db != nil {
+		if name, ok := db.subclasses[key]; ok {
+			return name
+		}
+	}
+	if name, ok := subclassNames[key]; ok {
+		return name
+	}
+	return fmt.Sprintf("Class %04x", key)
+}
@@ -0,0 +1,54 @@
+package pcie
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/chigopher/pathlib"
+)
+
+// readIOMMUGroup reads the group of the device from its iommu_group link.
+// A nil group is returned if the device isn't behind an IOMMU.
+func readIOMMUGroup(sysfsPath *pathlib.Path) (*int, error) {
+	group, err := sysfsPath.Join("iommu_group").Readlink()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading iommu_group link: %w", err)
+	}
+	id, err := strconv.Atoi(group.Name())
+	if err != nil {
+		return nil, fmt.Errorf("parsing iommu_group %q: %w", group.Name(), err)
+	}
+	return &id, nil
+}
+
+// IOMMUGroups lists the addresses of the devices in every IOMMU group under
+// /sys/kernel/iommu_groups. The map is empty if there is no IOMMU or it is
+// disabled.
+func (s *Sysfs) IOMMUGroups() (map[int][]string, error) {
+	groups := map[int][]string{}
+	dirs, err := s.Root.Join("kernel", "iommu_groups").ReadDir()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return groups, nil
+		}
+		return nil, fmt.Errorf("listing iommu groups: %w", err)
+	}
+	for _, dir := range dirs {
+		id, err := strconv.Atoi(dir.Name())
+		if err != nil {
+			continue
+		}
+		devices, err := dir.Join("devices").ReadDir()
+		if err != nil {
+			return nil, fmt.Errorf("listing devices of iommu group %d: %w", id, err)
+		}
+		for _, device := range devices {
+			groups[id] = append(groups[id], device.Name())
+		}
+	}
+	return groups, nil
+}
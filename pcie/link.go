@@ -0,0 +1,180 @@
+package pcie
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chigopher/pathlib"
+)
+
+// LinkSpeed is the speed of a PCI Express link, encoded the same way as the
+// Link Capabilities and Link Status registers: 1 is 2.5 GT/s (Gen1), 2 is
+// 5.0 GT/s (Gen2) and so on. Zero means the speed is unknown.
+type LinkSpeed uint8
+
+var linkSpeedRates = []float64{0, 2.5, 5.0, 8.0, 16.0, 32.0, 64.0}
+
+// Gen returns the PCI Express generation that introduced the speed.
+func (s LinkSpeed) Gen() int {
+	return int(s)
+}
+
+// GTps returns the raw bit rate per lane in gigatransfers per second.
+func (s LinkSpeed) GTps() float64 {
+	if int(s) >= len(linkSpeedRates) {
+		return 0
+	}
+	return linkSpeedRates[s]
+}
+
+// GBps returns the usable bandwidth per lane in gigabytes per second in
+// each direction, after the overhead of the line encoding.
+func (s LinkSpeed) GBps() float64 {
+	switch {
+	case s <= 2:
+		// 8b/10b
+		return s.GTps() * 8 / 10 / 8
+	case s <= 5:
+		// 128b/130b
+		return s.GTps() * 128 / 130 / 8
+	default:
+		// FLIT mode
+		return s.GTps() * 242 / 256 / 8
+	}
+}
+
+func (s LinkSpeed) String() string {
+	if s == 0 || int(s) >= len(linkSpeedRates) {
+		return "Unknown"
+	}
+	return fmt.Sprintf("%.1f GT/s", s.GTps())
+}
+
+func (s LinkSpeed) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *LinkSpeed) UnmarshalText(b []byte) error {
+	speed, err := ParseLinkSpeed(string(b))
+	if err != nil {
+		return err
+	}
+	*s = speed
+	return nil
+}
+
+// ParseLinkSpeed parses speeds as formatted by sysfs, such as "8.0 GT/s PCIe"
+// or "Unknown".
+func ParseLinkSpeed(s string) (LinkSpeed, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.HasPrefix(s, "Unknown") {
+		return 0, nil
+	}
+	rate, _, ok := strings.Cut(s, " GT/s")
+	if !ok {
+		return 0, fmt.Errorf("parsing link speed %q: missing GT/s unit", s)
+	}
+	f, err := strconv.ParseFloat(rate, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing link speed %q: %w", s, err)
+	}
+	for i, r := range linkSpeedRates {
+		if i > 0 && r == f {
+			return LinkSpeed(i), nil
+		}
+	}
+	return 0, fmt.Errorf("parsing link speed %q: unsupported rate", s)
+}
+
+// LinkStatus describes the speed and width a link trained at compared to
+// what it is capable of.
+type LinkStatus struct {
+	CurrentSpeed LinkSpeed `json:"current_speed" yaml:"current_speed"`
+	CurrentWidth int       `json:"current_width" yaml:"current_width"`
+	MaxSpeed     LinkSpeed `json:"max_speed" yaml:"max_speed"`
+	MaxWidth     int       `json:"max_width" yaml:"max_width"`
+}
+
+// Up reports whether the link has trained at all.
+func (l *LinkStatus) Up() bool {
+	return l != nil && l.CurrentSpeed != 0 && l.CurrentWidth != 0
+}
+
+// Downtrained reports whether the link trained below its maximum speed or
+// width. Links that are down are not considered downtrained.
+func (l *LinkStatus) Downtrained() bool {
+	if !l.Up() {
+		return false
+	}
+	return (l.MaxSpeed != 0 && l.CurrentSpeed < l.MaxSpeed) ||
+		(l.MaxWidth != 0 && l.CurrentWidth < l.MaxWidth)
+}
+
+// Bandwidth returns the usable bandwidth of the link as trained, in
+// gigabytes per second in each direction. It is zero if the link is down.
+func (l *LinkStatus) Bandwidth() float64 {
+	if !l.Up() {
+		return 0
+	}
+	return l.CurrentSpeed.GBps() * float64(l.CurrentWidth)
+}
+
+func (l *LinkStatus) String() string {
+	if l == nil {
+		return "Unknown"
+	}
+	return fmt.Sprintf("%s x%d (max %s x%d)", l.CurrentSpeed, l.CurrentWidth, l.MaxSpeed, l.MaxWidth)
+}
+
+// NewLinkStatusFromExpress returns the link status recorded in the Link
+// Capabilities and Link Status registers.
+func NewLinkStatusFromExpress(e *ExpressCapability) *LinkStatus {
+	return &LinkStatus{
+		CurrentSpeed: e.CurrentLinkSpeed,
+		CurrentWidth: e.CurrentLinkWidth,
+		MaxSpeed:     e.MaxLinkSpeed,
+		MaxWidth:     e.MaxLinkWidth,
+	}
+}
+
+// NewLinkStatusFromSysfs reads the current_link_* and max_link_* attributes
+// of a device. A nil LinkStatus is returned if the device doesn't have them,
+// which is the case for conventional PCI devices.
+func NewLinkStatusFromSysfs(sysfsPath *pathlib.Path) (*LinkStatus, error) {
+	l := &LinkStatus{}
+	for _, attr := range []struct {
+		name  string
+		speed *LinkSpeed
+		width *int
+	}{
+		{name: "current_link_speed", speed: &l.CurrentSpeed},
+		{name: "current_link_width", width: &l.CurrentWidth},
+		{name: "max_link_speed", speed: &l.MaxSpeed},
+		{name: "max_link_width", width: &l.MaxWidth},
+	} {
+		b, err := sysfsPath.Join(attr.name).ReadFile()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("reading %s: %w", attr.name, err)
+		}
+		value := strings.TrimSpace(string(b))
+		if attr.speed != nil {
+			speed, err := ParseLinkSpeed(value)
+			if err != nil {
+				return nil, err
+			}
+			*attr.speed = speed
+			continue
+		}
+		width, err := strconv.Atoi(strings.TrimPrefix(value, "x"))
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", attr.name, err)
+		}
+		*attr.width = width
+	}
+	return l, nil
+}
@@ -0,0 +1,124 @@
+package pcie
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chigopher/pathlib"
+)
+
+// SRIOV describes the virtual functions of an SR-IOV physical function.
+type SRIOV struct {
+	TotalVFs int `json:"total_vfs" yaml:"total_vfs"`
+	NumVFs   int `json:"num_vfs" yaml:"num_vfs"`
+	// Offset and Stride locate the VFs: the routing ID of the n'th VF,
+	// counting from 1, is the PF's plus Offset plus (n-1) times Stride.
+	Offset     *int `json:"offset,omitempty" yaml:"offset,omitempty"`
+	Stride     *int `json:"stride,omitempty" yaml:"stride,omitempty"`
+	VFDeviceID *ID  `json:"vf_device_id,omitempty" yaml:"vf_device_id,omitempty"`
+	// VFs are the addresses of the enabled VFs in order.
+	VFs []string `json:"vfs,omitempty" yaml:"vfs,omitempty"`
+}
+
+// readSysfsInt reads a sysfs attribute formatted as a decimal number. A nil
+// value is returned if the attribute does not exist.
+func readSysfsInt(sysfsPath *pathlib.Path, name string) (*int, error) {
+	b, err := sysfsPath.Join(name).ReadFile()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", name, err)
+	}
+	return &v, nil
+}
+
+// readSRIOV reads the sriov_* attributes and virtfn links of a physical
+// function. Kernels that don't expose the offset, stride or VF device ID
+// fall back to the SR-IOV capability in config, if it could be read. A nil
+// value is returned if the device isn't a physical function.
+func readSRIOV(sysfsPath *pathlib.Path, config *Config) (*SRIOV, error) {
+	total, err := readSysfsInt(sysfsPath, "sriov_totalvfs")
+	if err != nil || total == nil {
+		return nil, err
+	}
+	s := &SRIOV{TotalVFs: *total}
+	num, err := readSysfsInt(sysfsPath, "sriov_numvfs")
+	if err != nil {
+		return nil, err
+	}
+	if num != nil {
+		s.NumVFs = *num
+	}
+	if s.Offset, err = readSysfsInt(sysfsPath, "sriov_offset"); err != nil {
+		return nil, err
+	}
+	if s.Stride, err = readSysfsInt(sysfsPath, "sriov_stride"); err != nil {
+		return nil, err
+	}
+	vfDevice, err := readSysfsHex(sysfsPath, "sriov_vf_device", 16)
+	if err != nil {
+		return nil, err
+	}
+	if vfDevice != nil {
+		id := ID(*vfDevice)
+		s.VFDeviceID = &id
+	}
+	if config != nil {
+		if capability := config.SRIOV(); capability != nil {
+			if s.Offset == nil {
+				offset := int(capability.FirstVFOffset)
+				s.Offset = &offset
+			}
+			if s.Stride == nil {
+				stride := int(capability.VFStride)
+				s.Stride = &stride
+			}
+			if s.VFDeviceID == nil {
+				id := capability.VFDeviceID
+				s.VFDeviceID = &id
+			}
+		}
+	}
+
+	links, err := sysfsPath.Glob("virtfn*")
+	if err != nil {
+		return nil, fmt.Errorf("listing virtfn links: %w", err)
+	}
+	index := func(link *pathlib.Path) int {
+		i, _ := strconv.Atoi(strings.TrimPrefix(link.Name(), "virtfn"))
+		return i
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return index(links[i]) < index(links[j])
+	})
+	for _, link := range links {
+		vf, err := link.Readlink()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s link: %w", link.Name(), err)
+		}
+		s.VFs = append(s.VFs, vf.Name())
+	}
+	return s, nil
+}
+
+// readPhysFn returns the address of the physical function of a virtual
+// function, or nil if the device isn't a virtual function.
+func readPhysFn(sysfsPath *pathlib.Path) (*string, error) {
+	physfn, err := sysfsPath.Join("physfn").Readlink()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading physfn link: %w", err)
+	}
+	address := physfn.Name()
+	return &address, nil
+}
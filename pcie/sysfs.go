@@ -0,0 +1,247 @@
+package pcie
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/chigopher/pathlib"
+)
+
+var (
+	addressRegex = regexp.MustCompile(`^[0-9a-f]{4,}:[0-9a-f]{2}:[0-9a-f]{2}\.[0-7]$`)
+	rootBusRegex = regexp.MustCompile(`^pci([0-9a-f]{4,}:[0-9a-f]{2})$`)
+)
+
+// Device is a function in the PCI hierarchy along with the functions
+// behind it.
+type Device struct {
+	Details
+	Children []*Device
+}
+
+// Sysfs collects PCI devices from a sysfs mount. The root is configurable so
+// that a fake directory tree can stand in for /sys.
+type Sysfs struct {
+	Root *pathlib.Path
+	// IDs is used to resolve vendor and product names. It may be nil.
+	IDs *IDDatabase
+	// Aliases is used to find the modules that could drive each device. It
+	// may be nil.
+	Aliases *ModuleAliases
+}
+
+func NewSysfs(root *pathlib.Path) *Sysfs {
+	return &Sysfs{Root: root}
+}
+
+var DefaultSysfs = NewSysfs(pathlib.NewPath("/sys"))
+
+// DevicePath returns the path of the device with the given PCI address
+// under /sys/bus/pci/devices.
+func (s *Sysfs) DevicePath(address string) *pathlib.Path {
+	return s.Root.Join("bus", "pci", "devices", address)
+}
+
+// Walk builds the PCI hierarchy by resolving each entry of
+// /sys/bus/pci/devices to its location under /sys/devices. Every ancestor
+// directory that is itself a PCI function or a root bus (pciDDDD:BB) becomes
+// the parent of the device. The returned slice contains one Device per root
+// bus.
+func (s *Sysfs) Walk() ([]*Device, error) {
+	devicesDir, err := s.Root.Join("devices").ResolveAll()
+	if err != nil {
+		return nil, fmt.Errorf("resolving sysfs devices directory: %w", err)
+	}
+	devicesDir = devicesDir.Clean()
+	entries, err := s.Root.Join("bus", "pci", "devices").ReadDir()
+	if err != nil {
+		return nil, fmt.Errorf("listing pci devices: %w", err)
+	}
+
+	nodes := map[string]*Device{}
+	roots := []*Device{}
+	for _, entry := range entries {
+		resolved, err := entry.ResolveAll()
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", entry, err)
+		}
+		rel, err := resolved.Clean().RelativeTo(devicesDir)
+		if err != nil {
+			return nil, fmt.Errorf("locating %s under %s: %w", entry.Name(), devicesDir, err)
+		}
+
+		var parent *Device
+		parts := rel.Parts()
+		for i, part := range parts {
+			key := strings.Join(parts[:i+1], "/")
+			if node, ok := nodes[key]; ok {
+				parent = node
+				continue
+			}
+			var node *Device
+			switch {
+			case addressRegex.MatchString(part):
+				node, err = s.newDevice(devicesDir.Join(parts[:i+1]...), part)
+				if err != nil {
+					return nil, err
+				}
+			case rootBusRegex.MatchString(part):
+				node = newRootBus(rootBusRegex.FindStringSubmatch(part)[1])
+			default:
+				continue
+			}
+			nodes[key] = node
+			if parent == nil {
+				roots = append(roots, node)
+			} else {
+				parent.Children = append(parent.Children, node)
+			}
+			parent = node
+		}
+	}
+	if err := s.addIOMMUGroups(nodes); err != nil {
+		return nil, err
+	}
+	sortDevices(roots)
+	return roots, nil
+}
+
+// addIOMMUGroups fills in the group of devices whose iommu_group link is
+// missing from the listing of /sys/kernel/iommu_groups.
+func (s *Sysfs) addIOMMUGroups(nodes map[string]*Device) error {
+	groups, err := s.IOMMUGroups()
+	if err != nil {
+		return err
+	}
+	byAddress := map[string]int{}
+	for id, addresses := range groups {
+		for _, address := range addresses {
+			byAddress[address] = id
+		}
+	}
+	for _, node := range nodes {
+		if node.IOMMUGroup != nil {
+			continue
+		}
+		if id, ok := byAddress[node.Address()]; ok {
+			node.IOMMUGroup = &id
+		}
+	}
+	return nil
+}
+
+// addCandidateModules looks up the modules matching the device's modalias.
+func (s *Sysfs) addCandidateModules(d *AdditionalDetails) {
+	if d.DriverBinding != nil {
+		d.DriverBinding.CandidateModules = s.Aliases.Modules(d.DriverBinding.Modalias)
+	}
+}
+
+func sortDevices(devices []*Device) {
+	sort.SliceStable(devices, func(i, j int) bool {
+		return devices[i].Id < devices[j].Id
+	})
+	for _, d := range devices {
+		sortDevices(d.Children)
+	}
+}
+
+// Refresh re-reads the details of a device from sysfs. Root buses, which
+// have no address, are returned unchanged.
+func (s *Sysfs) Refresh(d Details) (Details, error) {
+	address := d.Address()
+	if address == "" {
+		return d, nil
+	}
+	path := s.DevicePath(address)
+	exists, err := path.Exists()
+	if err != nil {
+		return d, fmt.Errorf("checking for %s: %w", address, err)
+	}
+	if !exists {
+		return d, fmt.Errorf("%s is no longer present", address)
+	}
+	device, err := s.newDevice(path, address)
+	if err != nil {
+		return d, err
+	}
+	return device.Details, nil
+}
+
+func newRootBus(bus string) *Device {
+	return &Device{
+		Details: Details{
+			Id:          "pci" + bus,
+			Class:       "bridge",
+			Description: "Host bridge",
+			Handle:      "PCIBUS:" + bus,
+		},
+	}
+}
+
+func (s *Sysfs) newDevice(path *pathlib.Path, address string) (*Device, error) {
+	additional, err := NewAdditionalDetailsFromSysfs(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading details of %s: %w", address, err)
+	}
+	s.addCandidateModules(&additional)
+	d := Details{
+		AdditionalDetails: additional,
+		Id:                "pci" + address,
+		Businfo:           "pci@" + address,
+		Handle:            "PCI:" + address,
+		Physid:            physid(address),
+		Configuration:     map[string]any{},
+	}
+	if additional.ClassCode != nil {
+		d.Class = additional.ClassCode.LshwClass()
+		d.Description = s.IDs.Description(*additional.ClassCode)
+	}
+	if additional.VendorID != nil {
+		d.Vendor = s.IDs.Vendor(*additional.VendorID)
+		if additional.DeviceID != nil {
+			d.Product = s.IDs.Product(*additional.VendorID, *additional.DeviceID)
+		}
+	}
+	if additional.Revision != nil {
+		d.Version = fmt.Sprintf("%02x", uint8(*additional.Revision))
+	}
+
+	driver, err := path.Join("driver").Readlink()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading driver link of %s: %w", address, err)
+	}
+	if err == nil {
+		d.Claimed = true
+		d.Configuration["driver"] = driver.Name()
+	}
+
+	// Bridges expose the bus they forward to as pci_bus/DDDD:BB, which is
+	// what lshw uses as the handle.
+	buses, err := path.Join("pci_bus").ReadDir()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("listing pci_bus of %s: %w", address, err)
+	}
+	if len(buses) > 0 {
+		d.Handle = "PCIBUS:" + buses[0].Name()
+	}
+	return &Device{Details: d}, nil
+}
+
+// physid mirrors the physical ID lshw assigns to PCI functions: the device
+// number, followed by the function number if it is nonzero.
+func physid(address string) string {
+	devFunc := address[strings.LastIndex(address, ":")+1:]
+	dev, fn, _ := strings.Cut(devFunc, ".")
+	dev = strings.TrimLeft(dev, "0")
+	if dev == "" {
+		dev = "0"
+	}
+	if fn == "0" {
+		return dev
+	}
+	return dev + "." + fn
+}
@@ -0,0 +1,242 @@
+package pcie
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chigopher/pathlib"
+)
+
+// fakeSysfs builds a sysfs tree in a temporary directory.
+type fakeSysfs struct {
+	t    *testing.T
+	root string
+}
+
+func newFakeSysfs(t *testing.T) *fakeSysfs {
+	return &fakeSysfs{t: t, root: t.TempDir()}
+}
+
+// device creates the directory of a device at path under /sys/devices,
+// such as "pci0000:00/0000:00:01.0", with the given attributes, and links
+// it from /sys/bus/pci/devices.
+func (f *fakeSysfs) device(path string, attrs map[string]string) {
+	f.t.Helper()
+	dir := filepath.Join(f.root, "devices", path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		f.t.Fatal(err)
+	}
+	for name, value := range attrs {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value+"\n"), 0o644); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+	f.symlink(filepath.Join("bus", "pci", "devices", filepath.Base(path)), filepath.Join("devices", path))
+}
+
+// symlink creates a relative link at name pointing to target, both
+// relative to the root.
+func (f *fakeSysfs) symlink(name string, target string) {
+	f.t.Helper()
+	name = filepath.Join(f.root, name)
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		f.t.Fatal(err)
+	}
+	rel, err := filepath.Rel(filepath.Dir(name), filepath.Join(f.root, target))
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if err := os.Symlink(rel, name); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func (f *fakeSysfs) mkdir(path string) {
+	f.t.Helper()
+	if err := os.MkdirAll(filepath.Join(f.root, path), 0o755); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+const testPCIIDs = `# test pci.ids
+10de  NVIDIA Corporation
+	2330  GH100 [H100 SXM5 80GB]
+15b3  Mellanox Technologies
+	101d  MT2892 Family [ConnectX-6 Dx]
+C 02  Network controller
+	00  Ethernet controller
+`
+
+func TestSysfsWalk(t *testing.T) {
+	f := newFakeSysfs(t)
+	const (
+		rootPort = "pci0000:00/0000:00:01.0"
+		pf       = rootPort + "/0000:01:00.0"
+		vf       = rootPort + "/0000:01:00.1"
+		gpu      = "pci0000:40/0000:40:00.0"
+	)
+	f.device(rootPort, map[string]string{"vendor": "0x8086", "device": "0x347a", "class": "0x060400"})
+	f.mkdir(filepath.Join("devices", rootPort, "pci_bus", "0000:01"))
+	f.device(pf, map[string]string{
+		"vendor":             "0x15b3",
+		"device":             "0x101d",
+		"class":              "0x020000",
+		"numa_node":          "1",
+		"local_cpulist":      "16-31",
+		"current_link_speed": "8.0 GT/s PCIe",
+		"current_link_width": "8",
+		"max_link_speed":     "16.0 GT/s PCIe",
+		"max_link_width":     "16",
+		"sriov_totalvfs":     "8",
+		"sriov_numvfs":       "1",
+	})
+	f.device(vf, map[string]string{"vendor": "0x15b3", "device": "0x101e", "class": "0x020000"})
+	f.symlink(filepath.Join("devices", pf, "virtfn0"), filepath.Join("devices", vf))
+	f.symlink(filepath.Join("devices", vf, "physfn"), filepath.Join("devices", pf))
+	f.device(gpu, map[string]string{"vendor": "0x10de", "device": "0x2330", "class": "0x030200", "numa_node": "-1"})
+	// The PF has an iommu_group link; the GPU is only listed under
+	// /sys/kernel/iommu_groups.
+	f.symlink(filepath.Join("devices", pf, "iommu_group"), filepath.Join("kernel", "iommu_groups", "3"))
+	f.symlink(filepath.Join("kernel", "iommu_groups", "3", "devices", "0000:01:00.0"), filepath.Join("devices", pf))
+	f.symlink(filepath.Join("kernel", "iommu_groups", "7", "devices", "0000:40:00.0"), filepath.Join("devices", gpu))
+
+	idsPath := filepath.Join(t.TempDir(), "pci.ids")
+	if err := os.WriteFile(idsPath, []byte(testPCIIDs), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := LoadIDDatabase(pathlib.NewPath(idsPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sysfs := NewSysfs(pathlib.NewPath(f.root))
+	sysfs.IDs = ids
+
+	roots, err := sysfs.Walk()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 2 || roots[0].Handle != "PCIBUS:0000:00" || roots[1].Handle != "PCIBUS:0000:40" {
+		t.Fatalf("got %d root buses, want PCIBUS:0000:00 and PCIBUS:0000:40", len(roots))
+	}
+
+	devices := map[string]*Device{}
+	parents := map[string]string{}
+	var index func(parent *Device, children []*Device)
+	index = func(parent *Device, children []*Device) {
+		for _, d := range children {
+			devices[d.Handle] = d
+			parents[d.Handle] = parent.Handle
+			index(d, d.Children)
+		}
+	}
+	for _, root := range roots {
+		index(root, root.Children)
+	}
+
+	intPtr := func(i int) *int { return &i }
+	for _, tt := range []struct {
+		handle      string
+		parent      string
+		class       string
+		vendor      string
+		product     string
+		description string
+		numa        *int
+		link        *LinkStatus
+		iommuGroup  *int
+		physFn      string
+		vfs         []string
+	}{
+		{
+			handle:      "PCIBUS:0000:01",
+			parent:      "PCIBUS:0000:00",
+			class:       "bridge",
+			vendor:      "0x8086",
+			product:     "0x347a",
+			description: "PCI bridge",
+		},
+		{
+			handle:      "PCI:0000:01:00.0",
+			parent:      "PCIBUS:0000:01",
+			class:       "network",
+			vendor:      "Mellanox Technologies",
+			product:     "MT2892 Family [ConnectX-6 Dx]",
+			description: "Ethernet controller",
+			numa:        intPtr(1),
+			link:        &LinkStatus{CurrentSpeed: 3, CurrentWidth: 8, MaxSpeed: 4, MaxWidth: 16},
+			iommuGroup:  intPtr(3),
+			vfs:         []string{"0000:01:00.1"},
+		},
+		{
+			handle:      "PCI:0000:01:00.1",
+			parent:      "PCIBUS:0000:01",
+			class:       "network",
+			vendor:      "Mellanox Technologies",
+			product:     "0x101e",
+			description: "Ethernet controller",
+			physFn:      "0000:01:00.0",
+		},
+		{
+			handle:      "PCI:0000:40:00.0",
+			parent:      "PCIBUS:0000:40",
+			class:       "display",
+			vendor:      "NVIDIA Corporation",
+			product:     "GH100 [H100 SXM5 80GB]",
+			description: "3D controller",
+			numa:        intPtr(-1),
+			iommuGroup:  intPtr(7),
+		},
+	} {
+		t.Run(tt.handle, func(t *testing.T) {
+			d, ok := devices[tt.handle]
+			if !ok {
+				t.Fatal("device not found")
+			}
+			if parents[tt.handle] != tt.parent {
+				t.Errorf("parent = %s, want %s", parents[tt.handle], tt.parent)
+			}
+			if d.Class != tt.class || d.Vendor != tt.vendor || d.Product != tt.product || d.Description != tt.description {
+				t.Errorf("class, vendor, product, description = %q, %q, %q, %q, want %q, %q, %q, %q",
+					d.Class, d.Vendor, d.Product, d.Description, tt.class, tt.vendor, tt.product, tt.description)
+			}
+			if !equalIntPtr(d.NumaNode, tt.numa) {
+				t.Errorf("numa_node = %v, want %v", derefInt(d.NumaNode), derefInt(tt.numa))
+			}
+			if (d.Link == nil) != (tt.link == nil) || (d.Link != nil && *d.Link != *tt.link) {
+				t.Errorf("link = %s, want %s", d.Link, tt.link)
+			}
+			if !equalIntPtr(d.IOMMUGroup, tt.iommuGroup) {
+				t.Errorf("iommu_group = %v, want %v", derefInt(d.IOMMUGroup), derefInt(tt.iommuGroup))
+			}
+			physFn := ""
+			if d.PhysFn != nil {
+				physFn = *d.PhysFn
+			}
+			if physFn != tt.physFn {
+				t.Errorf("physfn = %q, want %q", physFn, tt.physFn)
+			}
+			var vfs []string
+			if d.SRIOV != nil {
+				vfs = d.SRIOV.VFs
+			}
+			if len(vfs) != len(tt.vfs) || (len(vfs) > 0 && vfs[0] != tt.vfs[0]) {
+				t.Errorf("VFs = %v, want %v", vfs, tt.vfs)
+			}
+		})
+	}
+	if got := *devices["PCI:0000:01:00.0"].LocalCPUList; got != "16-31" {
+		t.Errorf("local_cpulist = %q, want 16-31", got)
+	}
+}
+
+func equalIntPtr(a *int, b *int) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func derefInt(i *int) any {
+	if i == nil {
+		return nil
+	}
+	return *i
+}
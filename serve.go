@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/LandonTClipp/pciex/models"
+	"github.com/LandonTClipp/pciex/pcie"
+)
+
+// topologyCache rescans the topology in the background so that requests
+// are answered from memory. A failed rescan keeps the last topology. Trees
+// are never modified once they are cached, so they can be read
+// concurrently.
+type topologyCache struct {
+	opts   collectOptions
+	filter filterOption
+
+	mu        sync.RWMutex
+	tree      *models.TreeModel
+	scannedAt time.Time
+	duration  time.Duration
+	err       error
+}
+
+func (c *topologyCache) refresh() error {
+	start := time.Now()
+	tree, err := collectTree(c.opts)
+	if err == nil {
+		err = c.filter.apply(tree)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scannedAt = start
+	c.duration = time.Since(start)
+	c.err = err
+	if err == nil {
+		c.tree = tree
+	}
+	return err
+}
+
+// run rescans every interval until the process exits.
+func (c *topologyCache) run(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := c.refresh(); err != nil {
+			log.Printf("rescanning topology: %v", err)
+		}
+	}
+}
+
+// get returns the last topology that was scanned successfully and when it
+// was scanned.
+func (c *topologyCache) get() (*models.TreeModel, time.Time) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tree, c.scannedAt
+}
+
+func (c *topologyCache) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	c.mu.RLock()
+	tree, scannedAt, duration, err := c.tree, c.scannedAt, c.duration, c.err
+	c.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := tree.WriteMetrics(w); err != nil {
+		log.Printf("writing metrics: %v", err)
+		return
+	}
+	success := 1
+	if err != nil {
+		success = 0
+	}
+	fmt.Fprintf(w, "# HELP pciex_scan_success Whether the last scan of the topology succeeded.\n# TYPE pciex_scan_success gauge\npciex_scan_success %d\n", success)
+	fmt.Fprintf(w, "# HELP pciex_scan_timestamp_seconds When the last scan of the topology started.\n# TYPE pciex_scan_timestamp_seconds gauge\npciex_scan_timestamp_seconds %d\n", scannedAt.Unix())
+	fmt.Fprintf(w, "# HELP pciex_scan_duration_seconds How long the last scan of the topology took.\n# TYPE pciex_scan_duration_seconds gauge\npciex_scan_duration_seconds %g\n", duration.Seconds())
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Printf("encoding response: %v", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+// serveTopology answers with the same document as pciex export.
+func (c *topologyCache) serveTopology(w http.ResponseWriter, r *http.Request) {
+	tree, scannedAt := c.get()
+	snapshot := models.NewSnapshot(tree.Root, tree.Hostname, c.opts.collectorName())
+	snapshot.CollectedAt = scannedAt.UTC()
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+// device returns the device at the address in the request's path, or
+// answers with 404 and returns nil.
+func (c *topologyCache) device(w http.ResponseWriter, r *http.Request) *models.Node {
+	tree, _ := c.get()
+	address := pcie.NormalizeAddress(r.PathValue("bdf"))
+	for _, n := range tree.Devices() {
+		if n.Detail.Address() == address {
+			return n
+		}
+	}
+	writeJSONError(w, http.StatusNotFound, "no device at %s", address)
+	return nil
+}
+
+func (c *topologyCache) serveDevice(w http.ResponseWriter, r *http.Request) {
+	if n := c.device(w, r); n != nil {
+		writeJSON(w, http.StatusOK, n.Detail)
+	}
+}
+
+func (c *topologyCache) serveDeviceConfig(w http.ResponseWriter, r *http.Request) {
+	n := c.device(w, r)
+	if n == nil {
+		return
+	}
+	if n.Detail.Config == nil {
+		writeJSONError(w, http.StatusNotFound, "the configuration space of %s was not read", n.Detail.Address())
+		return
+	}
+	writeJSON(w, http.StatusOK, n.Detail.Config)
+}
+
+// serveSearch answers with the devices whose address, vendor, product,
+// class or driver contain q, like / in the explorer.
+func (c *topologyCache) serveSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		writeJSONError(w, http.StatusBadRequest, "missing query parameter q")
+		return
+	}
+	tree, _ := c.get()
+	matches := []pcie.Details{}
+	for _, n := range tree.Devices() {
+		if n.MatchesQuery(query) {
+			matches = append(matches, n.Detail)
+		}
+	}
+	writeJSON(w, http.StatusOK, matches)
+}
+
+func runServe(args []string) error {
+	var (
+		cache    topologyCache
+		metrics  string
+		api      string
+		interval time.Duration
+	)
+	fs := newFlagSet("pciex serve", "")
+	cache.opts.register(fs)
+	cache.filter.register(fs)
+	fs.StringVar(&metrics, "metrics", "", "address to serve Prometheus metrics on at /metrics, such as :9840")
+	fs.StringVar(&api, "http", "", "address to serve the JSON API on, such as :9841; may be the same as -metrics")
+	fs.DurationVar(&interval, "interval", 30*time.Second, "how often to rescan the topology")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if metrics == "" && api == "" {
+		fs.Usage()
+		return errors.New("-metrics or -http is required")
+	}
+	if err := cache.refresh(); err != nil {
+		return err
+	}
+	if cache.opts.from == "" {
+		go cache.run(interval)
+	}
+
+	muxes := map[string]*http.ServeMux{}
+	mux := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+	if metrics != "" {
+		mux(metrics).HandleFunc("GET /metrics", cache.serveMetrics)
+		log.Printf("serving metrics on %s/metrics", metrics)
+	}
+	if api != "" {
+		m := mux(api)
+		m.HandleFunc("GET /topology", cache.serveTopology)
+		m.HandleFunc("GET /devices/{bdf}", cache.serveDevice)
+		m.HandleFunc("GET /devices/{bdf}/config", cache.serveDeviceConfig)
+		m.HandleFunc("GET /search", cache.serveSearch)
+		log.Printf("serving the JSON API on %s", api)
+	}
+
+	errs := make(chan error, len(muxes))
+	for addr, m := range muxes {
+		go func() {
+			errs <- http.ListenAndServe(addr, m)
+		}()
+	}
+	return <-errs
+}
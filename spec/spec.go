@@ -0,0 +1,241 @@
+// Package spec checks a topology against a declarative description of what
+// a machine model is expected to look like.
+package spec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/LandonTClipp/pciex/models"
+	"github.com/chigopher/pathlib"
+	"gopkg.in/yaml.v2"
+)
+
+// Spec is the expected topology of a machine model, for example:
+//
+//	name: HGX H100
+//	rules:
+//	  - name: GPUs
+//	    match:
+//	      class: display
+//	      vendor: nvidia
+//	    count: 8
+//	    distinct_switches: 4
+//	    link:
+//	      gen: 5
+//	      width: 16
+//	    numa:
+//	      0: 4
+//	      1: 4
+type Spec struct {
+	Name  string `yaml:"name"`
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule describes a group of devices. Every field other than Match is
+// optional; only the fields that are set are checked.
+type Rule struct {
+	Name  string `yaml:"name"`
+	Match Match  `yaml:"match"`
+	// Count is the exact number of devices that must match.
+	Count *int `yaml:"count"`
+	// DistinctSwitches is the number of different PCIe switches the
+	// matching devices must be spread across.
+	DistinctSwitches *int `yaml:"distinct_switches"`
+	// Link is the minimum link every matching device must have trained at.
+	Link *Link `yaml:"link"`
+	// NUMA is the number of matching devices expected on each NUMA node.
+	NUMA map[int]int `yaml:"numa"`
+}
+
+// Match selects devices. Class must be equal to the lshw class, the other
+// fields are case-insensitive substrings. Empty fields match everything.
+// SR-IOV virtual functions are only matched if VF is true, in which case
+// only they are, so that enabling VFs doesn't change the count of physical
+// devices.
+type Match struct {
+	Class       string `yaml:"class"`
+	Vendor      string `yaml:"vendor"`
+	Product     string `yaml:"product"`
+	Description string `yaml:"description"`
+	Driver      string `yaml:"driver"`
+	Businfo     string `yaml:"businfo"`
+	VF          bool   `yaml:"vf"`
+}
+
+type Link struct {
+	Gen   int `yaml:"gen"`
+	Width int `yaml:"width"`
+}
+
+func (l Link) String() string {
+	s := []string{}
+	if l.Gen != 0 {
+		s = append(s, fmt.Sprintf("Gen%d", l.Gen))
+	}
+	if l.Width != 0 {
+		s = append(s, fmt.Sprintf("x%d", l.Width))
+	}
+	return strings.Join(s, " ")
+}
+
+func Load(path *pathlib.Path) (*Spec, error) {
+	b, err := path.ReadFile()
+	if err != nil {
+		return nil, fmt.Errorf("reading spec: %w", err)
+	}
+	s := &Spec{}
+	if err := yaml.UnmarshalStrict(b, s); err != nil {
+		return nil, fmt.Errorf("unmarshalling spec: %w", err)
+	}
+	for i, rule := range s.Rules {
+		if rule.Name == "" {
+			s.Rules[i].Name = fmt.Sprintf("rule %d", i+1)
+		}
+	}
+	return s, nil
+}
+
+func containsFold(s string, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func (m Match) Matches(n *models.Node) bool {
+	d := n.Detail
+	if d.Businfo == "" || n.IsVirtualFunction() != m.VF {
+		return false
+	}
+	return (m.Class == "" || d.Class == m.Class) &&
+		containsFold(d.Vendor, m.Vendor) &&
+		containsFold(d.Product, m.Product) &&
+		containsFold(d.Description, m.Description) &&
+		containsFold(d.Driver(), m.Driver) &&
+		containsFold(d.Businfo, m.Businfo)
+}
+
+// RuleResult is the outcome of checking one rule. The rule passed if there
+// are no failures.
+type RuleResult struct {
+	Rule     Rule
+	Matched  int
+	Failures []string
+}
+
+type Report struct {
+	Spec    *Spec
+	Results []RuleResult
+}
+
+func (r Report) Passed() bool {
+	for _, result := range r.Results {
+		if len(result.Failures) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Report) String() string {
+	var (
+		b      strings.Builder
+		failed int
+	)
+	fmt.Fprintf(&b, "Spec: %s\n", r.Spec.Name)
+	for _, result := range r.Results {
+		if len(result.Failures) == 0 {
+			fmt.Fprintf(&b, "PASS %s (%d devices)\n", result.Rule.Name, result.Matched)
+			continue
+		}
+		failed++
+		fmt.Fprintf(&b, "FAIL %s (%d devices)\n", result.Rule.Name, result.Matched)
+		for _, failure := range result.Failures {
+			fmt.Fprintf(&b, "    %s\n", failure)
+		}
+	}
+	if failed == 0 {
+		fmt.Fprintf(&b, "All %d rules passed\n", len(r.Results))
+	} else {
+		fmt.Fprintf(&b, "%d of %d rules failed\n", failed, len(r.Results))
+	}
+	return b.String()
+}
+
+// Validate checks the tree under root against every rule of the spec.
+func (s *Spec) Validate(root *models.Node) Report {
+	report := Report{Spec: s}
+	for _, rule := range s.Rules {
+		report.Results = append(report.Results, rule.check(root))
+	}
+	return report
+}
+
+func (r Rule) check(root *models.Node) RuleResult {
+	matched := []*models.Node{}
+	root.Walk(func(n *models.Node) bool {
+		if r.Match.Matches(n) {
+			matched = append(matched, n)
+		}
+		return true
+	})
+	result := RuleResult{Rule: r, Matched: len(matched)}
+
+	if r.Count != nil && len(matched) != *r.Count {
+		result.Failures = append(result.Failures, fmt.Sprintf("expected %d devices, found %d", *r.Count, len(matched)))
+	}
+
+	if r.DistinctSwitches != nil {
+		switches := map[*models.Node]bool{}
+		for _, n := range matched {
+			if sw := n.Switch(); sw != nil {
+				switches[sw] = true
+			}
+		}
+		if len(switches) != *r.DistinctSwitches {
+			result.Failures = append(result.Failures, fmt.Sprintf("expected devices under %d distinct switches, found %d", *r.DistinctSwitches, len(switches)))
+		}
+	}
+
+	if r.Link != nil {
+		for _, n := range matched {
+			link := n.Detail.Link
+			switch {
+			case !link.Up():
+				result.Failures = append(result.Failures, fmt.Sprintf("%s: link is down or unknown, expected %s", n.Detail.Businfo, r.Link))
+			case link.CurrentSpeed.Gen() < r.Link.Gen || link.CurrentWidth < r.Link.Width:
+				result.Failures = append(result.Failures, fmt.Sprintf("%s: link is Gen%d x%d, expected %s", n.Detail.Businfo, link.CurrentSpeed.Gen(), link.CurrentWidth, r.Link))
+			}
+		}
+	}
+
+	if r.NUMA != nil {
+		found := map[int]int{}
+		unknown := []string{}
+		for _, n := range matched {
+			if numa := n.Detail.NumaNode; numa != nil && *numa >= 0 {
+				found[*numa]++
+			} else {
+				unknown = append(unknown, n.Detail.Businfo)
+			}
+		}
+		if len(unknown) > 0 {
+			result.Failures = append(result.Failures, fmt.Sprintf("NUMA node unknown for %s", strings.Join(unknown, ", ")))
+		}
+		nodes := []int{}
+		for numa := range r.NUMA {
+			nodes = append(nodes, numa)
+		}
+		for numa := range found {
+			if _, ok := r.NUMA[numa]; !ok {
+				nodes = append(nodes, numa)
+			}
+		}
+		sort.Ints(nodes)
+		for _, numa := range nodes {
+			if found[numa] != r.NUMA[numa] {
+				result.Failures = append(result.Failures, fmt.Sprintf("expected %d devices on NUMA node %d, found %d", r.NUMA[numa], numa, found[numa]))
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,147 @@
+package spec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/LandonTClipp/pciex/models"
+	"github.com/LandonTClipp/pciex/pcie"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func addDevice(parent *models.Node, address string, class string, vendor string) *models.Node {
+	detail := pcie.Details{Businfo: "pci@" + address, Class: class, Vendor: vendor, Handle: "PCI:" + address}
+	if class == "bridge" {
+		detail.Handle = "PCIBUS:" + address
+	}
+	return parent.AddChild(detail.String(), detail)
+}
+
+// newTree builds two switches with a GPU behind each, on NUMA nodes 0 and 1,
+// and a NIC with two virtual functions whose NUMA node is unknown.
+func newTree() *models.Node {
+	tree := models.NewTreeModel()
+	root := models.NewNode("root", pcie.Details{}, nil, tree)
+	rc := root.AddChild("rc", pcie.Details{Class: "bridge", Handle: "PCIBUS:0000:00"})
+	for numa, addresses := range [][]string{
+		{"0000:00:01.0", "0000:01:00.0", "0000:02:00.0", "0000:03:00.0"},
+		{"0000:00:05.0", "0000:05:00.0", "0000:06:00.0", "0000:07:00.0"},
+	} {
+		rp := addDevice(rc, addresses[0], "bridge", "")
+		up := addDevice(rp, addresses[1], "bridge", "")
+		down := addDevice(up, addresses[2], "bridge", "")
+		gpu := addDevice(down, addresses[3], "display", "NVIDIA Corporation")
+		gpu.Detail.NumaNode = intPtr(numa)
+		gpu.Detail.Link = &pcie.LinkStatus{CurrentSpeed: 5, CurrentWidth: 16, MaxSpeed: 5, MaxWidth: 16}
+	}
+	rp := addDevice(rc, "0000:00:09.0", "bridge", "")
+	addDevice(rp, "0000:09:00.0", "network", "Mellanox Technologies")
+	for _, address := range []string{"0000:09:00.1", "0000:09:00.2"} {
+		vf := addDevice(rp, address, "network", "Mellanox Technologies")
+		physFn := "0000:09:00.0"
+		vf.Detail.PhysFn = &physFn
+	}
+	return root
+}
+
+func TestMatchMatches(t *testing.T) {
+	root := newTree()
+	for _, tt := range []struct {
+		name  string
+		match Match
+		want  []string
+	}{
+		{"class", Match{Class: "display"}, []string{"pci@0000:03:00.0", "pci@0000:07:00.0"}},
+		{"class is exact", Match{Class: "disp"}, nil},
+		{"vendor substring", Match{Vendor: "nvidia"}, []string{"pci@0000:03:00.0", "pci@0000:07:00.0"}},
+		{"businfo", Match{Class: "display", Businfo: "07:"}, []string{"pci@0000:07:00.0"}},
+		{"all fields", Match{Class: "display", Vendor: "NVIDIA", Businfo: "03:00"}, []string{"pci@0000:03:00.0"}},
+		{"physical functions only", Match{Class: "network"}, []string{"pci@0000:09:00.0"}},
+		{"virtual functions", Match{Class: "network", VF: true}, []string{"pci@0000:09:00.1", "pci@0000:09:00.2"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			root.Walk(func(n *models.Node) bool {
+				if tt.match.Matches(n) {
+					got = append(got, n.Detail.Businfo)
+				}
+				return true
+			})
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("matched %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	root := newTree()
+	for _, tt := range []struct {
+		name string
+		rule Rule
+		want []string
+	}{
+		{
+			name: "GPUs pass",
+			rule: Rule{
+				Match:            Match{Class: "display"},
+				Count:            intPtr(2),
+				DistinctSwitches: intPtr(2),
+				Link:             &Link{Gen: 5, Width: 16},
+				NUMA:             map[int]int{0: 1, 1: 1},
+			},
+		},
+		{
+			name: "VFs don't count",
+			rule: Rule{Match: Match{Class: "network"}, Count: intPtr(1)},
+		},
+		{
+			name: "VFs asked for",
+			rule: Rule{Match: Match{Class: "network", VF: true}, Count: intPtr(2)},
+		},
+		{
+			name: "count",
+			rule: Rule{Match: Match{Class: "display"}, Count: intPtr(8)},
+			want: []string{"expected 8 devices, found 2"},
+		},
+		{
+			name: "switches",
+			rule: Rule{Match: Match{Class: "display"}, DistinctSwitches: intPtr(4)},
+			want: []string{"expected devices under 4 distinct switches, found 2"},
+		},
+		{
+			name: "link",
+			rule: Rule{Match: Match{Class: "display", Businfo: "03:00"}, Link: &Link{Gen: 6}},
+			want: []string{"pci@0000:03:00.0: link is Gen5 x16, expected Gen6"},
+		},
+		{
+			name: "link unknown",
+			rule: Rule{Match: Match{Class: "network"}, Link: &Link{Width: 16}},
+			want: []string{"pci@0000:09:00.0: link is down or unknown, expected x16"},
+		},
+		{
+			name: "NUMA",
+			rule: Rule{Match: Match{Class: "display"}, NUMA: map[int]int{0: 2}},
+			want: []string{"expected 2 devices on NUMA node 0, found 1", "expected 0 devices on NUMA node 1, found 1"},
+		},
+		{
+			name: "NUMA unknown",
+			rule: Rule{Match: Match{Class: "network", VF: true}, NUMA: map[int]int{0: 2}},
+			want: []string{"NUMA node unknown for pci@0000:09:00.1, pci@0000:09:00.2", "expected 2 devices on NUMA node 0, found 0"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			report := (&Spec{Rules: []Rule{tt.rule}}).Validate(root)
+			got := report.Results[0].Failures
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("failures = %q, want %q", got, tt.want)
+			}
+			if report.Passed() != (len(tt.want) == 0) {
+				t.Errorf("Passed() = %v with failures %q", report.Passed(), got)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/LandonTClipp/pciex/models"
+)
+
+func runTopo(args []string) error {
+	var (
+		opts   collectOptions
+		filter string
+	)
+	fs := newFlagSet("pciex topo", "")
+	opts.register(fs)
+	fs.StringVar(&filter, "filter", models.DefaultP2PFilter, "filter expression selecting the devices to compare")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	f, err := models.ParseFilter(filter)
+	if err != nil {
+		return err
+	}
+	tree, err := collectTree(opts)
+	if err != nil {
+		return err
+	}
+	fmt.Print(models.NewP2PMatrix(models.P2PDevices(tree.Root, f)).String())
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/LandonTClipp/pciex/spec"
+	"github.com/chigopher/pathlib"
+)
+
+func runValidate(args []string) error {
+	var (
+		opts     collectOptions
+		specPath string
+	)
+	fs := newFlagSet("pciex validate", "")
+	opts.register(fs)
+	fs.StringVar(&specPath, "spec", "", "YAML file describing the expected topology")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if specPath == "" {
+		fs.Usage()
+		return errors.New("-spec is required")
+	}
+	s, err := spec.Load(pathlib.NewPath(specPath))
+	if err != nil {
+		return err
+	}
+	tree, err := collectTree(opts)
+	if err != nil {
+		return err
+	}
+	report := s.Validate(tree.Root)
+	fmt.Print(report)
+	if !report.Passed() {
+		return exitCode(1)
+	}
+	return nil
+}